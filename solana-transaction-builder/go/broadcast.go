@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	confirm "github.com/gagliardetto/solana-go/rpc/sendAndConfirmTransaction"
+	"github.com/gagliardetto/solana-go/rpc/ws"
+
+	"signer/send"
+)
+
+// CONFIRM_TIMEOUT bounds how long a broadcast waits for finalization, matching
+// the default of confirm.WaitForConfirmation.
+const CONFIRM_TIMEOUT = 2 * time.Minute
+
+// errWSUnavailable is wrapped by errors caused by the WebSocket endpoint
+// being unreachable or dropping the connection.
+var errWSUnavailable = errors.New("WS unavailable")
+
+var strictWS = flag.Bool("strict-ws", false, "fail instead of falling back to polling when the WebSocket endpoint is unreachable")
+
+// minContextSlot resolves the -min-context-slot flag. observedSlot is the slot
+// the transaction's blockhash was fetched at, or 0 when it is not known.
+func minContextSlot(observedSlot uint64) *uint64 {
+	switch {
+	case *minSlotFlag < 0:
+		return nil
+	case *minSlotFlag > 0:
+		slot := uint64(*minSlotFlag)
+		return &slot
+	case observedSlot > 0:
+		return &observedSlot
+	}
+	return nil
+}
+
+// connectWS connects to the WebSocket endpoint, retrying -ws-retries times
+// with exponential backoff starting at -ws-backoff.
+func connectWS(ctx context.Context, out io.Writer) (*ws.Client, error) {
+	backoff := *wsBackoff
+	for attempt := 0; ; attempt++ {
+		wsClient, err := ws.Connect(ctx, *wsURL)
+		if err == nil {
+			return wsClient, nil
+		}
+		if attempt >= *wsRetries {
+			return nil, fmt.Errorf("error connecting to WS after %d attempt(s): %w", attempt+1, err)
+		}
+		fmt.Fprintf(out, "WS connection failed (%v), retrying in %s\n", err, backoff)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// broadcastTransaction sends a fully signed transaction and waits for its
+// confirmation, over the WebSocket endpoint when one is configured and by
+// polling GetSignatureStatuses otherwise. The minimum context slot makes a
+// node that lags behind the one that served the blockhash reject the
+// transaction instead of silently dropping it. timer may be nil.
+func broadcastTransaction(client *rpc.Client, tx *solana.Transaction, observedSlot uint64, timer *phaseTimer) (solana.Signature, error) {
+	sig, _, err := broadcastWithReport(os.Stdout, client, tx, observedSlot, timer)
+	return sig, err
+}
+
+// broadcastWithReport is broadcastTransaction that also returns the on-chain
+// record of the confirmed transaction, or nil if it could not be fetched.
+// Progress is printed to out.
+func broadcastWithReport(out io.Writer, client *rpc.Client, tx *solana.Transaction, observedSlot uint64, timer *phaseTimer) (solana.Signature, *transactionReport, error) {
+	timer.begin(PHASE_BROADCAST)
+	if err := validateSignedTransaction(tx); err != nil {
+		return solana.Signature{}, nil, fmt.Errorf("refusing to broadcast: %w", err)
+	}
+	ctx, cancel := withOperationDeadline(context.Background())
+	defer cancel()
+	var wsClient *ws.Client
+	if *wsURL != "" {
+		// Open a WebSocket connection for transaction confirmation.
+		var err error
+		wsClient, err = connectWS(ctx, out)
+		if err != nil && *strictWS {
+			return solana.Signature{}, nil, fmt.Errorf("%w, refusing to broadcast (-strict-ws): %w", errWSUnavailable, err)
+		}
+		if err != nil {
+			warnTo(out, "%v - falling back to polling for confirmation", err)
+		} else {
+			defer wsClient.Close()
+		}
+	}
+
+	opts := rpc.TransactionOpts{
+		PreflightCommitment: rpc.CommitmentFinalized,
+		MinContextSlot:      minContextSlot(observedSlot),
+	}
+	sig, err := client.SendTransactionWithOpts(ctx, tx, opts)
+	if err != nil {
+		err = deadlineError(PHASE_BROADCAST, fmt.Errorf("error sending transaction: %w", err))
+		recordCSV(out, tx, nil, err)
+		return sig, nil, err
+	}
+
+	timer.begin(PHASE_CONFIRM)
+	if wsClient != nil {
+		var confirmed bool
+		confirmed, err = confirm.WaitForConfirmation(ctx, wsClient, sig, nil)
+		if err != nil && !confirmed && !isTimeout(err) {
+			err = fmt.Errorf("%w while confirming: %w", errWSUnavailable, err)
+		}
+	} else {
+		err = pollForConfirmation(ctx, client, sig, *pollInterval)
+	}
+	if err != nil {
+		err = deadlineError(PHASE_CONFIRM, fmt.Errorf("error confirming transaction %s: %w", sig, err))
+		recordCSV(out, tx, nil, err)
+		return sig, nil, err
+	}
+	timer.end()
+	report := printTransactionReport(ctx, out, client, tx, sig)
+	recordCSV(out, tx, report, nil)
+	return sig, report, nil
+}
+
+// simulateBeforeSigning simulates the still unsigned tx so a transaction that
+// would fail preflight is refused before the device asks for a button press.
+func simulateBeforeSigning(out io.Writer, client *rpc.Client, tx *solana.Transaction) error {
+	resp, err := simulateUnsigned(client, tx, false)
+	if err != nil {
+		return err
+	}
+	switch resp.Value.Err {
+	case nil:
+		return nil
+	case "BlockhashNotFound":
+		return fmt.Errorf("simulation failed: %w", send.ErrBlockhashNotFound)
+	}
+	if *verbose {
+		for _, line := range resp.Value.Logs {
+			fmt.Fprintln(out, "  "+line)
+		}
+	}
+	return fmt.Errorf("simulation failed, not asking the device to sign: %v", resp.Value.Err)
+}
+
+// pollForConfirmation polls GetSignatureStatuses every interval until sig is
+// finalized, fails on-chain, or CONFIRM_TIMEOUT passes.
+func pollForConfirmation(ctx context.Context, client *rpc.Client, sig solana.Signature, interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("poll interval must be positive, got %s", interval)
+	}
+	ctx, cancel := context.WithTimeout(ctx, CONFIRM_TIMEOUT)
+	defer cancel()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		statuses, err := client.GetSignatureStatuses(ctx, false, sig)
+		if err == nil && len(statuses.Value) > 0 && statuses.Value[0] != nil {
+			status := statuses.Value[0]
+			if status.Err != nil {
+				return fmt.Errorf("transaction failed: %v", status.Err)
+			}
+			if status.ConfirmationStatus == rpc.ConfirmationStatusFinalized {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("not finalized within %s: %w", CONFIRM_TIMEOUT, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
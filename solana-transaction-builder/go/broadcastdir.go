@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// loadSignedTransactionFile reads a signed transaction from path. The file is
+// either a completed signature bundle or a base64/base58 serialized
+// transaction, decoded as sign-tx does, and every signature in it must verify.
+func loadSignedTransactionFile(path string) (*solana.Transaction, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimSpace(data)
+
+	if len(data) > 0 && data[0] == '{' {
+		var b signatureBundle
+		if err := json.Unmarshal(data, &b); err != nil {
+			return nil, fmt.Errorf("error parsing bundle: %w", err)
+		}
+		return b.transaction()
+	}
+	tx, err := decodeEncodedTransaction(string(data), "")
+	if err != nil {
+		return nil, err
+	}
+	if err := validateSignedTransaction(tx); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// moveTo moves path into the subdirectory sub of its directory.
+func moveTo(path, sub string) error {
+	dir := filepath.Join(filepath.Dir(path), sub)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	return os.Rename(path, filepath.Join(dir, filepath.Base(path)))
+}
+
+// runBroadcastDir broadcasts every signed transaction file dropped into a
+// directory, moving each file to done/ or failed/. Files are submitted in file
+// name order; with -concurrency above 1 they may confirm out of order.
+func runBroadcastDir(args []string) error {
+	fs := flag.NewFlagSet("broadcast-dir", flag.ExitOnError)
+	dir := fs.String("dir", ".", "directory holding signed transaction files")
+	concurrency := fs.Int("concurrency", 1, "how many transactions to broadcast and confirm at once")
+	rate := fs.Float64("rate", 0, "maximum broadcasts per second (0 for no limit)")
+	fs.Parse(args)
+	if *concurrency < 1 {
+		return fmt.Errorf("-concurrency must be at least 1")
+	}
+
+	entries, err := os.ReadDir(*dir)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := withOperationDeadline(context.Background())
+	defer cancel()
+	client, err := newRPCClient()
+	if err != nil {
+		return err
+	}
+
+	// os.ReadDir returns entries sorted by name, which is the broadcast order.
+	var paths []string
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		paths = append(paths, filepath.Join(*dir, entry.Name()))
+	}
+
+	progress := newBatchProgress(len(paths))
+	finish := func(path string, sig solana.Signature, reason error, note string) {
+		sub := "done"
+		if reason != nil {
+			sub = "failed"
+			progress.printf("FAILED %s: %v\n", filepath.Base(path), reason)
+		} else {
+			progress.printf("DONE   %s: %s%s\n", filepath.Base(path), sig, note)
+		}
+		if err := moveTo(path, sub); err != nil {
+			progress.printf("  could not move file: %v\n", err)
+		}
+		progress.resolve(reason == nil)
+	}
+
+	type job struct {
+		path string
+		tx   *solana.Transaction
+	}
+	jobs := make(chan job)
+	var limiter <-chan time.Time
+	if *rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / *rate))
+		defer ticker.Stop()
+		limiter = ticker.C
+	}
+	var workers sync.WaitGroup
+	for i := 0; i < *concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for j := range jobs {
+				sig := j.tx.Signatures[0]
+				// A file may be dropped again after an earlier run already landed it.
+				statuses, err := client.GetSignatureStatuses(ctx, true, sig)
+				if err == nil && len(statuses.Value) > 0 && statuses.Value[0] != nil && statuses.Value[0].Err == nil {
+					finish(j.path, sig, nil, " already landed")
+					continue
+				}
+				if limiter != nil {
+					<-limiter
+				}
+				_, _, err = broadcastWithReport(progress, client, j.tx, 0, nil)
+				finish(j.path, sig, err, "")
+			}
+		}()
+	}
+
+	seen := map[solana.Signature]string{}
+	for _, path := range paths {
+		tx, err := loadSignedTransactionFile(path)
+		if err != nil {
+			finish(path, solana.Signature{}, err, "")
+			continue
+		}
+		sig := tx.Signatures[0]
+		if first, ok := seen[sig]; ok {
+			finish(path, sig, fmt.Errorf("duplicate of %s", first), "")
+			continue
+		}
+		seen[sig] = filepath.Base(path)
+		jobs <- job{path, tx}
+	}
+	close(jobs)
+	workers.Wait()
+	progress.finish()
+
+	fmt.Printf("Broadcast %d file(s), %d failed\n", progress.confirmed, progress.failed)
+	if progress.failed > 0 {
+		return fmt.Errorf("%d file(s) failed", progress.failed)
+	}
+	return nil
+}
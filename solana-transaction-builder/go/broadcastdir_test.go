@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mr-tron/base58"
+)
+
+func TestLoadSignedTransactionFile(t *testing.T) {
+	fixture, err := buildFixtureTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := fixture.ToBase64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := fixture.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsigned := fixture.Message.ToBase64()
+
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{"signed base64", signed + "\n", ""},
+		{"signed base58", base58.Encode(raw), ""},
+		{"bare message", unsigned, "missing"},
+		{"garbage", "not a transaction", "neither"},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "tx")
+			if err := os.WriteFile(path, []byte(tt.data), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			tx, err := loadSignedTransactionFile(path)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("loadSignedTransactionFile: %v", err)
+				}
+				if tx.Signatures[0] != fixture.Signatures[0] {
+					t.Fatalf("loaded signature %s, want %s", tx.Signatures[0], fixture.Signatures[0])
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("loadSignedTransactionFile = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/mr-tron/base58"
+)
+
+// unsignedTransaction is the output of build-tx: an unsigned transaction for
+// signing elsewhere, with the metadata a signer needs to check it.
+type unsignedTransaction struct {
+	// Transaction is the serialized transaction with zeroed signature slots.
+	Transaction string `json:"transaction"`
+	// Message is the serialized message, i.e. the bytes to be signed.
+	Message              string   `json:"message"`
+	Encoding             string   `json:"encoding"`
+	Blockhash            string   `json:"blockhash"`
+	LastValidBlockHeight uint64   `json:"lastValidBlockHeight"`
+	FeePayer             string   `json:"feePayer"`
+	Signers              []string `json:"signers"`
+}
+
+// encodeBytes encodes b as base64 or base58.
+func encodeBytes(b []byte, encoding string) (string, error) {
+	switch encoding {
+	case "base64":
+		return base64.StdEncoding.EncodeToString(b), nil
+	case "base58":
+		return base58.Encode(b), nil
+	}
+	return "", fmt.Errorf("unknown encoding %q (want base64 or base58)", encoding)
+}
+
+// runBuildTx builds a transfer, or the raw instructions given with
+// -instructions, without contacting the device and prints it unsigned, so
+// another signer can sign it.
+func runBuildTx(args []string) error {
+	fs := flag.NewFlagSet("build-tx", flag.ExitOnError)
+	transfer := addTransferFlags(fs)
+	encoding := fs.String("encoding", "base64", "encoding of the transaction and message: base64 or base58")
+	out := fs.String("out", "-", "file to write the result to (- for stdout)")
+	instructions := fs.String("instructions", "", "file with a JSON array of raw instructions to build instead of a transfer")
+	fs.Parse(args)
+
+	if *transfer.from == "" {
+		return fmt.Errorf("build-tx needs -from since the device is not contacted")
+	}
+	params, err := transfer.params(solana.PublicKey{})
+	if err != nil {
+		return err
+	}
+	client, err := newRPCClient()
+	if err != nil {
+		return err
+	}
+	var tx *solana.Transaction
+	var blockhash blockhashInfo
+	if *instructions != "" {
+		tx, blockhash, err = buildRawTransaction(client, *instructions, params.FeePayer)
+	} else {
+		tx, blockhash, err = createUnsignedTransaction(os.Stdout, client, params)
+	}
+	if err != nil {
+		return fmt.Errorf("error creating transaction: %w", err)
+	}
+	tx.Signatures = make([]solana.Signature, tx.Message.Header.NumRequiredSignatures)
+
+	txBytes, err := tx.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	msgBytes, err := tx.Message.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	result := unsignedTransaction{
+		Encoding:             *encoding,
+		Blockhash:            tx.Message.RecentBlockhash.String(),
+		LastValidBlockHeight: blockhash.LastValidBlockHeight,
+		FeePayer:             params.FeePayer.String(),
+	}
+	if result.Transaction, err = encodeBytes(txBytes, *encoding); err != nil {
+		return err
+	}
+	if result.Message, err = encodeBytes(msgBytes, *encoding); err != nil {
+		return err
+	}
+	for _, signer := range tx.Message.Signers() {
+		result.Signers = append(result.Signers, signer.String())
+	}
+
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	if *out == "-" {
+		fmt.Println(string(data))
+		return nil
+	}
+	return os.WriteFile(*out, append(data, '\n'), 0o644)
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	bin "github.com/gagliardetto/binary"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// signatureBundle is the file format used to collect signatures for one
+// message from several hardware wallets before it is broadcast.
+type signatureBundle struct {
+	// Message is the base64-encoded serialized transaction message.
+	Message string `json:"message"`
+	// NonceAccount is set when the message uses a durable nonce from this
+	// account instead of a recent blockhash.
+	NonceAccount string            `json:"nonceAccount,omitempty"`
+	Signatures   []bundleSignature `json:"signatures"`
+}
+
+// bundleSignature is a single collected signature and the key that made it.
+type bundleSignature struct {
+	Signer    string `json:"signer"`
+	Signature string `json:"signature"`
+}
+
+// loadBundle reads a signature bundle from path.
+func loadBundle(path string) (*signatureBundle, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var b signatureBundle
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("error parsing bundle %s: %w", path, err)
+	}
+	return &b, nil
+}
+
+// save writes the bundle to path.
+func (b *signatureBundle) save(path string) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o600)
+}
+
+// message decodes the bundled message, returning it with its raw bytes.
+func (b *signatureBundle) message() (*solana.Message, []byte, error) {
+	msgBytes, err := base64.StdEncoding.DecodeString(b.Message)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error decoding bundle message: %w", err)
+	}
+	var msg solana.Message
+	if err := msg.UnmarshalWithDecoder(bin.NewBinDecoder(msgBytes)); err != nil {
+		return nil, nil, fmt.Errorf("error parsing bundle message: %w", err)
+	}
+	return &msg, msgBytes, nil
+}
+
+// signatureFor returns the collected signature of signer, if any.
+func (b *signatureBundle) signatureFor(signer solana.PublicKey) (solana.Signature, bool, error) {
+	for _, s := range b.Signatures {
+		if s.Signer != signer.String() {
+			continue
+		}
+		sig, err := solana.SignatureFromBase58(s.Signature)
+		if err != nil {
+			return solana.Signature{}, false, fmt.Errorf("invalid signature for %s: %w", s.Signer, err)
+		}
+		return sig, true, nil
+	}
+	return solana.Signature{}, false, nil
+}
+
+// addSignature records sig for signer, replacing any earlier one.
+func (b *signatureBundle) addSignature(signer solana.PublicKey, sig solana.Signature) {
+	for i, s := range b.Signatures {
+		if s.Signer == signer.String() {
+			b.Signatures[i].Signature = sig.String()
+			return
+		}
+	}
+	b.Signatures = append(b.Signatures, bundleSignature{Signer: signer.String(), Signature: sig.String()})
+}
+
+// missingSigners lists the required signers that have not signed yet.
+func (b *signatureBundle) missingSigners() ([]solana.PublicKey, error) {
+	msg, _, err := b.message()
+	if err != nil {
+		return nil, err
+	}
+	var missing []solana.PublicKey
+	for _, signer := range msg.Signers() {
+		if _, ok, err := b.signatureFor(signer); err != nil {
+			return nil, err
+		} else if !ok {
+			missing = append(missing, signer)
+		}
+	}
+	return missing, nil
+}
+
+// transaction assembles the signed transaction, placing each signature in the
+// slot of its signer. Every required signature must be present and valid.
+func (b *signatureBundle) transaction() (*solana.Transaction, error) {
+	msg, msgBytes, err := b.message()
+	if err != nil {
+		return nil, err
+	}
+	tx := &solana.Transaction{Message: *msg}
+	for _, signer := range msg.Signers() {
+		sig, ok, err := b.signatureFor(signer)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("missing signature from %s", signer)
+		}
+		if !sig.Verify(signer, msgBytes) {
+			return nil, fmt.Errorf("invalid signature from %s", signer)
+		}
+		tx.Signatures = append(tx.Signatures, sig)
+	}
+	return tx, nil
+}
+
+// checkUsable refuses a bundle whose transaction can no longer land, so no
+// device is asked to sign it: a blockhash must not have expired and a durable
+// nonce must not have been advanced.
+func (b *signatureBundle) checkUsable(client *rpc.Client, msg *solana.Message) error {
+	if b.NonceAccount != "" {
+		account, err := solana.PublicKeyFromBase58(b.NonceAccount)
+		if err != nil {
+			return fmt.Errorf("invalid bundle nonce account %q: %w", b.NonceAccount, err)
+		}
+		nonce, err := fetchNonce(client, account)
+		if err != nil {
+			return err
+		}
+		if !nonce.Nonce.Equals(msg.RecentBlockhash) {
+			return fmt.Errorf("nonce account %s has been advanced since the bundle was created; create a new bundle", account)
+		}
+		return nil
+	}
+	ctx, cancel := withOperationDeadline(context.Background())
+	defer cancel()
+	valid, err := client.IsBlockhashValid(ctx, msg.RecentBlockhash, rpc.CommitmentProcessed)
+	if err != nil {
+		return deadlineError(PHASE_BUILD, fmt.Errorf("error checking bundle blockhash %s: %w", msg.RecentBlockhash, err))
+	}
+	if !valid.Value {
+		return fmt.Errorf("bundle blockhash %s has expired; create a new bundle, with -nonce-account to collect signatures over more than a minute", msg.RecentBlockhash)
+	}
+	return nil
+}
+
+// runBundleCreate builds an unsigned transfer and writes it to a new bundle.
+// The device is only contacted when -from is not given. With -nonce-account
+// the transfer uses that durable nonce, so the bundle does not expire while
+// signatures are collected.
+func runBundleCreate(args []string) error {
+	fs := flag.NewFlagSet("bundle-create", flag.ExitOnError)
+	transfer := addTransferFlags(fs)
+	out := fs.String("out", "bundle.json", "bundle file to write")
+	var nonceAccount pubkeyFlag
+	fs.Var(&nonceAccount, "nonce-account", "durable nonce account to build on instead of a recent blockhash; its authority must sign")
+	fs.Parse(args)
+
+	var device solana.PublicKey
+	if *transfer.from == "" {
+		esp32, err := openESP32()
+		if err != nil {
+			return err
+		}
+		device, err = getESP32PublicKey(esp32)
+		esp32.Close()
+		if err != nil {
+			return fmt.Errorf("error getting ESP32 public key: %w", err)
+		}
+	}
+	params, err := transfer.params(device)
+	if err != nil {
+		return err
+	}
+
+	client, err := newRPCClient()
+	if err != nil {
+		return err
+	}
+	tx, blockhash, err := createUnsignedTransaction(os.Stdout, client, params)
+	if err != nil {
+		return fmt.Errorf("error creating transaction: %w", err)
+	}
+	if tx, _, err = checkComputeBudget(os.Stdout, client, &params, tx, blockhash, *transfer.autoComputeLimit); err != nil {
+		return err
+	}
+	b := &signatureBundle{}
+	if account := solana.PublicKey(nonceAccount); !account.IsZero() {
+		nonce, err := fetchNonce(client, account)
+		if err != nil {
+			return err
+		}
+		if tx, err = createNonceTransaction(params, nonce); err != nil {
+			return fmt.Errorf("error creating transaction: %w", err)
+		}
+		b.NonceAccount = account.String()
+		fmt.Printf("Using durable nonce %s from %s, advanced by %s\n", nonce.Nonce, account, nonce.Authority)
+	}
+	if err := printTransferSummary(os.Stdout, client, params, tx, *transfer.noDust); err != nil {
+		return err
+	}
+	b.Message = tx.Message.ToBase64()
+	if err := b.save(*out); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote bundle %s requiring %d signature(s):\n", *out, len(tx.Message.Signers()))
+	for _, signer := range tx.Message.Signers() {
+		fmt.Println(" ", signer)
+	}
+	return nil
+}
+
+// runBundleSign adds the connected device's signature to a bundle and, unless
+// disabled, broadcasts it once that completes the signature set.
+func runBundleSign(args []string) error {
+	fs := flag.NewFlagSet("bundle-sign", flag.ExitOnError)
+	in := fs.String("in", "bundle.json", "bundle file to update")
+	broadcast := fs.Bool("broadcast", true, "broadcast the bundle as soon as this signature completes it")
+	fs.Parse(args)
+
+	b, err := loadBundle(*in)
+	if err != nil {
+		return err
+	}
+	msg, msgBytes, err := b.message()
+	if err != nil {
+		return err
+	}
+	client, err := newRPCClient()
+	if err != nil {
+		return err
+	}
+	if err := b.checkUsable(client, msg); err != nil {
+		return err
+	}
+
+	esp32, err := openESP32()
+	if err != nil {
+		return err
+	}
+	defer esp32.Close()
+
+	esp32Pubkey, err := getESP32PublicKey(esp32)
+	if err != nil {
+		return fmt.Errorf("error getting ESP32 public key: %w", err)
+	}
+	if !msg.IsSigner(esp32Pubkey) {
+		return fmt.Errorf("device key %s is not a required signer of this bundle", esp32Pubkey)
+	}
+	if _, ok, err := b.signatureFor(esp32Pubkey); err != nil {
+		return err
+	} else if ok {
+		return fmt.Errorf("bundle already holds a signature from %s", esp32Pubkey)
+	}
+
+	signature, err := signMessageWithESP32(esp32, msgBytes)
+	if err != nil {
+		return fmt.Errorf("error receiving signature: %w", err)
+	}
+	if !signature.Verify(esp32Pubkey, msgBytes) {
+		return fmt.Errorf("signature from device does not verify against %s", esp32Pubkey)
+	}
+	b.addSignature(esp32Pubkey, signature)
+	if err := b.save(*in); err != nil {
+		return err
+	}
+
+	missing, err := b.missingSigners()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Added signature from %s; %d signature(s) remaining\n", esp32Pubkey, len(missing))
+	for _, signer := range missing {
+		fmt.Println(" ", signer)
+	}
+	if len(missing) > 0 {
+		return nil
+	}
+	if !*broadcast {
+		fmt.Printf("All signatures collected; run bundle-broadcast -in %s to send it\n", *in)
+		return nil
+	}
+	fmt.Println("All signatures collected, broadcasting")
+	return broadcastBundle(b)
+}
+
+// runBundleBroadcast broadcasts a bundle once all signatures are collected.
+func runBundleBroadcast(args []string) error {
+	fs := flag.NewFlagSet("bundle-broadcast", flag.ExitOnError)
+	in := fs.String("in", "bundle.json", "bundle file to broadcast")
+	fs.Parse(args)
+
+	b, err := loadBundle(*in)
+	if err != nil {
+		return err
+	}
+	return broadcastBundle(b)
+}
+
+// broadcastBundle broadcasts a fully signed bundle.
+func broadcastBundle(b *signatureBundle) error {
+	tx, err := b.transaction()
+	if err != nil {
+		return err
+	}
+
+	// The blockhash was fetched in an earlier run, so only an explicit
+	// -min-context-slot applies here.
+	client, err := newRPCClient()
+	if err != nil {
+		return err
+	}
+	sig, err := broadcastTransaction(client, tx, 0, nil)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Transaction submitted with signature:", sig)
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	bin "github.com/gagliardetto/binary"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/programs/system"
+)
+
+// nonceAccountReply answers getAccountInfo with an initialized nonce account
+// storing nonce.
+func nonceAccountReply(t *testing.T, authority solana.PublicKey, nonce solana.Hash) func([]json.RawMessage) rpcReply {
+	var buf bytes.Buffer
+	state := system.NonceAccount{Version: 1, State: NONCE_STATE_INITIALIZED, AuthorizedPubkey: authority, Nonce: solana.PublicKey(nonce)}
+	if err := state.MarshalWithEncoder(bin.NewBinEncoder(&buf)); err != nil {
+		t.Fatal(err)
+	}
+	return func([]json.RawMessage) rpcReply {
+		return withContext(map[string]interface{}{
+			"data":       []string{base64.StdEncoding.EncodeToString(buf.Bytes()), "base64"},
+			"executable": false,
+			"lamports":   1_447_680,
+			"owner":      solana.SystemProgramID.String(),
+			"rentEpoch":  0,
+		})
+	}
+}
+
+// testBundle returns a bundle of a transfer from a new wallet built on the
+// nonce stored in account, or on nonce as a plain blockhash when account is
+// zero.
+func testBundle(t *testing.T, account solana.PublicKey, nonce solana.Hash) (*signatureBundle, *solana.Message, solana.PublicKey) {
+	t.Helper()
+	from := solana.NewWallet().PublicKey()
+	params := transferParams{From: from, FeePayer: from, Payments: []payment{{Recipient: solana.NewWallet().PublicKey(), Lamports: 1000}}}
+	b := &signatureBundle{}
+	var tx *solana.Transaction
+	var err error
+	if account.IsZero() {
+		tx, err = solana.NewTransaction(transferInstructions(params), nonce, solana.TransactionPayer(from))
+	} else {
+		tx, err = createNonceTransaction(params, durableNonce{Account: account, Authority: from, Nonce: nonce})
+		b.NonceAccount = account.String()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Message = tx.Message.ToBase64()
+	msg, _, err := b.message()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b, msg, from
+}
+
+func TestCreateNonceTransactionAdvancesFirst(t *testing.T) {
+	account := solana.NewWallet().PublicKey()
+	nonce := solana.Hash{7}
+	_, msg, authority := testBundle(t, account, nonce)
+
+	if !msg.RecentBlockhash.Equals(nonce) {
+		t.Fatalf("blockhash = %s, want the nonce %s", msg.RecentBlockhash, nonce)
+	}
+	first := msg.Instructions[0]
+	program, err := msg.Program(first.ProgramIDIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst, err := system.DecodeInstruction(nil, first.Data)
+	if err != nil || !program.Equals(solana.SystemProgramID) {
+		t.Fatalf("first instruction is not a system instruction: %v", err)
+	}
+	if _, ok := inst.Impl.(*system.AdvanceNonceAccount); !ok {
+		t.Fatalf("first instruction is %T, want AdvanceNonceAccount", inst.Impl)
+	}
+	if !msg.IsSigner(authority) {
+		t.Fatal("the nonce authority is not a signer")
+	}
+}
+
+func TestBundleCheckUsableBlockhash(t *testing.T) {
+	b, msg, _ := testBundle(t, solana.PublicKey{}, solana.Hash{1})
+	for _, valid := range []bool{true, false} {
+		handlers := chainHandlers()
+		handlers["isBlockhashValid"] = func([]json.RawMessage) rpcReply { return withContext(valid) }
+		err := b.checkUsable(fakeRPC(t, handlers), msg)
+		if valid && err != nil {
+			t.Fatalf("checkUsable with a valid blockhash: %v", err)
+		}
+		if !valid && (err == nil || !strings.Contains(err.Error(), "expired")) {
+			t.Fatalf("checkUsable with an expired blockhash = %v, want an expiry error", err)
+		}
+	}
+}
+
+func TestBundleCheckUsableNonce(t *testing.T) {
+	account := solana.NewWallet().PublicKey()
+	nonce := solana.Hash{7}
+	b, msg, authority := testBundle(t, account, nonce)
+
+	handlers := chainHandlers()
+	handlers["getAccountInfo"] = nonceAccountReply(t, authority, nonce)
+	if err := b.checkUsable(fakeRPC(t, handlers), msg); err != nil {
+		t.Fatalf("checkUsable with the current nonce: %v", err)
+	}
+
+	handlers["getAccountInfo"] = nonceAccountReply(t, authority, solana.Hash{8})
+	err := b.checkUsable(fakeRPC(t, handlers), msg)
+	if err == nil || !strings.Contains(err.Error(), "advanced") {
+		t.Fatalf("checkUsable with an advanced nonce = %v, want an error", err)
+	}
+}
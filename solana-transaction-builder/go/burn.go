@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/programs/token"
+)
+
+// runBurn burns tokens from the ESP32 wallet's associated token account using
+// a decimals-checked Burn instruction.
+func runBurn(args []string) error {
+	fs := flag.NewFlagSet("burn", flag.ExitOnError)
+	mintFlag := fs.String("mint", "", "mint of the token to burn")
+	amountFlag := fs.String("amount", "", "amount to burn, in tokens (e.g. 1.5)")
+	fs.Parse(args)
+
+	mintAddr, err := solana.PublicKeyFromBase58(*mintFlag)
+	if err != nil {
+		return fmt.Errorf("invalid mint %q: %w", *mintFlag, err)
+	}
+
+	ctx, cancel := withOperationDeadline(context.Background())
+	defer cancel()
+	client, err := newRPCClient()
+	if err != nil {
+		return err
+	}
+	mint, err := fetchMint(ctx, client, mintAddr)
+	if err != nil {
+		return err
+	}
+	amount, err := parseTokenAmount(*amountFlag, mint.Decimals)
+	if err != nil {
+		return err
+	}
+	if amount == 0 {
+		return fmt.Errorf("burn amount must be greater than zero")
+	}
+
+	esp32, err := openESP32()
+	if err != nil {
+		return err
+	}
+	defer esp32.Close()
+
+	owner, err := getESP32PublicKey(esp32)
+	if err != nil {
+		return fmt.Errorf("error getting ESP32 public key: %w", err)
+	}
+	tokenAccount, err := associatedTokenAddress(owner, mint)
+	if err != nil {
+		return err
+	}
+	if err := checkTokenFunds(ctx, client, tokenAccount, mint, amount); err != nil {
+		return err
+	}
+
+	inst, err := withProgram(token.NewBurnCheckedInstruction(
+		amount, mint.Decimals, tokenAccount, mint.Address, owner, nil,
+	).Build(), mint.Program)
+	if err != nil {
+		return err
+	}
+	tx, blockhash, err := buildTransaction(os.Stdout, client, []solana.Instruction{inst}, owner)
+	if err != nil {
+		return fmt.Errorf("error creating transaction: %w", err)
+	}
+	fmt.Printf("Burning %s of %s from %s\n", formatTokenAmount(amount, mint.Decimals), mint.Address, tokenAccount)
+
+	if err := signWithESP32(esp32, owner, tx); err != nil {
+		return err
+	}
+	sig, err := broadcastTransaction(client, tx, blockhash.Slot, nil)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Transaction submitted with signature:", sig)
+	return nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// MAX_CLOCK_SKEW is how far the local clock may drift from the cluster's block
+// time before a warning is printed. Finalized blocks trail real time by a few
+// seconds, well within this margin.
+const MAX_CLOCK_SKEW = 60 * time.Second
+
+// clockSkew returns how far the local clock is ahead of the block time the
+// cluster reports for slot. A negative value means the local clock is behind.
+func clockSkew(ctx context.Context, client *rpc.Client, slot uint64) (time.Duration, error) {
+	blockTime, err := client.GetBlockTime(ctx, slot)
+	if err != nil {
+		return 0, fmt.Errorf("error fetching block time of slot %d: %w", slot, err)
+	}
+	if blockTime == nil {
+		return 0, fmt.Errorf("no block time for slot %d", slot)
+	}
+	return time.Since(blockTime.Time()).Round(time.Second), nil
+}
+
+// checkClockSkew warns when the local clock disagrees with the cluster, since
+// confirmation timeouts are measured on the local clock and a large skew makes
+// an expiry look premature or overdue. The skew is printed with -verbose.
+func checkClockSkew(ctx context.Context, out io.Writer, client *rpc.Client, slot uint64) {
+	skew, err := clockSkew(ctx, client, slot)
+	if err != nil {
+		if *verbose {
+			fmt.Fprintln(out, "Clock skew unknown:", err)
+		}
+		return
+	}
+	if *verbose {
+		fmt.Fprintf(out, "Clock skew vs cluster block time: %s\n", skew)
+	}
+	if skew > MAX_CLOCK_SKEW || skew < -MAX_CLOCK_SKEW {
+		warnTo(out, "local clock differs from the cluster by %s; check the system time if confirmations time out unexpectedly", skew)
+	}
+}
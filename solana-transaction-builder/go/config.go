@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+var configDirFlag = flag.String("config-dir", "", "directory for saved settings (default: the user config dir + /esp32-signer)")
+
+// configDir returns the directory holding the tool's saved state.
+func configDir() (string, error) {
+	if *configDirFlag != "" {
+		return *configDirFlag, nil
+	}
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "esp32-signer"), nil
+}
+
+// loadConfigFile decodes the JSON file name in the config directory into v,
+// leaving v untouched when the file does not exist yet.
+func loadConfigFile(name string, v interface{}) error {
+	dir, err := configDir()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("error parsing %s: %w", filepath.Join(dir, name), err)
+	}
+	return nil
+}
+
+// saveConfigFile writes v as JSON to the file name in the config directory.
+func saveConfigFile(name string, v interface{}) error {
+	dir, err := configDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, name), append(data, '\n'), 0o600)
+}
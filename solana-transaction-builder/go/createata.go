@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// runCreateATA creates the associated token account of a wallet for a mint,
+// paid and signed by the ESP32, without moving any tokens.
+func runCreateATA(args []string) error {
+	fs := flag.NewFlagSet("create-ata", flag.ExitOnError)
+	ownerFlag := fs.String("owner", "", "wallet to create the token account for")
+	mintFlag := fs.String("mint", "", "mint of the token account")
+	fs.Parse(args)
+
+	wallet, err := solana.PublicKeyFromBase58(*ownerFlag)
+	if err != nil {
+		return fmt.Errorf("invalid owner %q: %w", *ownerFlag, err)
+	}
+	mintAddr, err := solana.PublicKeyFromBase58(*mintFlag)
+	if err != nil {
+		return fmt.Errorf("invalid mint %q: %w", *mintFlag, err)
+	}
+
+	ctx, cancel := withOperationDeadline(context.Background())
+	defer cancel()
+	client, err := newRPCClient()
+	if err != nil {
+		return err
+	}
+	mint, err := fetchMint(ctx, client, mintAddr)
+	if err != nil {
+		return err
+	}
+	ata, err := associatedTokenAddress(wallet, mint)
+	if err != nil {
+		return err
+	}
+	exists, err := accountExists(ctx, client, ata)
+	if err != nil {
+		return fmt.Errorf("error fetching token account %s: %w", ata, err)
+	}
+	if exists {
+		fmt.Printf("Token account %s for %s already exists; nothing to do\n", ata, wallet)
+		return nil
+	}
+
+	esp32, err := openESP32()
+	if err != nil {
+		return err
+	}
+	defer esp32.Close()
+	payer, err := getESP32PublicKey(esp32)
+	if err != nil {
+		return fmt.Errorf("error getting ESP32 public key: %w", err)
+	}
+
+	createATA, err := createATAInstruction(payer, wallet, mint)
+	if err != nil {
+		return err
+	}
+	tx, blockhash, err := buildTransaction(os.Stdout, client, []solana.Instruction{createATA}, payer)
+	if err != nil {
+		return fmt.Errorf("error creating transaction: %w", err)
+	}
+	fmt.Printf("Creating token account %s for %s (mint %s)\n", ata, wallet, mint.Address)
+	if err := signWithESP32(esp32, payer, tx); err != nil {
+		return err
+	}
+	sig, err := broadcastTransaction(client, tx, blockhash.Slot, nil)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Transaction submitted with signature:", sig)
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/csv"
+	"flag"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+var csvOut = flag.String("csv-out", "", "append a CSV row per broadcast transfer to this file for bookkeeping")
+
+// CSV_COLUMNS is the header of the -csv-out file. New columns go at the end so
+// existing spreadsheets keep working.
+var CSV_COLUMNS = []string{"timestamp", "recipient", "amount_lamports", "fee_lamports", "signature", "status"}
+
+// csvMu serializes appends from concurrent broadcasts.
+var csvMu sync.Mutex
+
+// systemTransfers returns the SOL transfers made by tx through the system
+// program.
+func systemTransfers(tx *solana.Transaction) []payment {
+	msg := tx.Message
+	var payments []payment
+	for _, inst := range msg.Instructions {
+		program, err := msg.Program(inst.ProgramIDIndex)
+		if err != nil || !program.Equals(solana.SystemProgramID) {
+			continue
+		}
+		// Transfer is system instruction 2: a u32 tag and a u64 amount.
+		if len(inst.Data) != 12 || binary.LittleEndian.Uint32(inst.Data[:4]) != 2 || len(inst.Accounts) < 2 {
+			continue
+		}
+		if int(inst.Accounts[1]) >= len(msg.AccountKeys) {
+			continue
+		}
+		payments = append(payments, payment{
+			Recipient: msg.AccountKeys[inst.Accounts[1]],
+			Lamports:  binary.LittleEndian.Uint64(inst.Data[4:]),
+		})
+	}
+	return payments
+}
+
+// recordCSV appends the outcome of broadcasting tx to the -csv-out file: one
+// row per SOL transfer, or a single row without recipient for other
+// transactions. report may be nil when the fee is unknown. A failed write is
+// warned about on out.
+func recordCSV(out io.Writer, tx *solana.Transaction, report *transactionReport, broadcastErr error) {
+	if *csvOut == "" {
+		return
+	}
+	status := "confirmed"
+	if broadcastErr != nil {
+		status = "failed: " + broadcastErr.Error()
+	}
+	fee := ""
+	if report != nil {
+		fee = strconv.FormatUint(report.Fee, 10)
+	}
+	signature := ""
+	if len(tx.Signatures) > 0 {
+		signature = tx.Signatures[0].String()
+	}
+	timestamp := time.Now().UTC().Format(time.RFC3339)
+
+	var rows [][]string
+	for _, pay := range systemTransfers(tx) {
+		rows = append(rows, []string{timestamp, pay.Recipient.String(), strconv.FormatUint(pay.Lamports, 10), fee, signature, status})
+	}
+	if len(rows) == 0 {
+		rows = append(rows, []string{timestamp, "", "", fee, signature, status})
+	}
+
+	if err := appendCSV(*csvOut, rows); err != nil {
+		warnTo(out, "could not write %s: %v", *csvOut, err)
+	}
+}
+
+// appendCSV appends rows to path, writing the header first if the file is new
+// or empty.
+func appendCSV(path string, rows [][]string) error {
+	csvMu.Lock()
+	defer csvMu.Unlock()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	if info.Size() == 0 {
+		if err := w.Write(CSV_COLUMNS); err != nil {
+			return err
+		}
+	}
+	if err := w.WriteAll(rows); err != nil {
+		return err
+	}
+	return f.Close()
+}
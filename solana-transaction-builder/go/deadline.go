@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+)
+
+var deadlineFlag = flag.Duration("deadline", 0, "overall time budget for the command, shared by every retry and wait (0 disables)")
+
+// operationDeadline is when the -deadline budget runs out; zero means never.
+var operationDeadline time.Time
+
+// errDeadline is wrapped by every error caused by the -deadline budget.
+var errDeadline = errors.New("operation deadline exceeded")
+
+// startDeadline starts the -deadline budget. main calls it once flags are
+// parsed.
+func startDeadline() {
+	if *deadlineFlag > 0 {
+		operationDeadline = time.Now().Add(*deadlineFlag)
+	}
+}
+
+// withOperationDeadline derives a context that ends with the -deadline budget.
+func withOperationDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	if operationDeadline.IsZero() {
+		return context.WithCancel(ctx)
+	}
+	return context.WithDeadline(ctx, operationDeadline)
+}
+
+// checkDeadline fails once the -deadline budget is spent, naming the phase
+// that was about to run.
+func checkDeadline(phase string) error {
+	if operationDeadline.IsZero() || time.Now().Before(operationDeadline) {
+		return nil
+	}
+	return fmt.Errorf("%w: -deadline %s ran out in %s phase", errDeadline, *deadlineFlag, phase)
+}
+
+// capToDeadline shortens a wait of d to what is left of the -deadline
+// budget.
+func capToDeadline(d time.Duration) time.Duration {
+	if operationDeadline.IsZero() {
+		return d
+	}
+	return max(0, min(d, time.Until(operationDeadline)))
+}
+
+// deadlineError attributes err to the -deadline budget if the budget is spent.
+func deadlineError(phase string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if budget := checkDeadline(phase); budget != nil {
+		return fmt.Errorf("%w: %w", budget, err)
+	}
+	return err
+}
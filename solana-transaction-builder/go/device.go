@@ -0,0 +1,439 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	bin "github.com/gagliardetto/binary"
+	"github.com/gagliardetto/solana-go"
+	"github.com/mr-tron/base58"
+	"github.com/tarm/serial"
+)
+
+// MAX_RESPONSE_LINE bounds a single response line. The longest valid answer, a
+// signature with an echoed blockhash, is well under this.
+const MAX_RESPONSE_LINE = 1024
+
+// messageEncoding is how the message to sign is encoded on the wire.
+type messageEncoding string
+
+const (
+	encodingBase64 messageEncoding = "base64"
+	encodingBase58 messageEncoding = "base58"
+)
+
+func (e *messageEncoding) String() string { return string(*e) }
+
+func (e *messageEncoding) Set(s string) error {
+	switch v := messageEncoding(strings.ToLower(s)); v {
+	case encodingBase64, encodingBase58:
+		*e = v
+		return nil
+	}
+	return fmt.Errorf("unknown message encoding %q (want base64 or base58)", s)
+}
+
+var outgoingEncoding = encodingBase64
+
+func init() {
+	flag.Var(&outgoingEncoding, "message-encoding", "encoding of the message sent to the ESP32 for signing: base64 or base58")
+}
+
+// encodeMessage encodes msgBytes for the signing request.
+func encodeMessage(msgBytes []byte, encoding messageEncoding) string {
+	if encoding == encodingBase58 {
+		return base58.Encode(msgBytes)
+	}
+	return base64.StdEncoding.EncodeToString(msgBytes)
+}
+
+// checkMessageEncoding fails unless encoding is one of the encodings the
+// firmware lists in its "enc" handshake field. Firmware without the field
+// base64-decodes whatever it receives, so it only accepts base64: a base58
+// message that is also valid base64 would be signed as different bytes.
+func checkMessageEncoding(info firmwareInfo, encoding messageEncoding) error {
+	accepted, ok := info.Fields["enc"]
+	if !ok {
+		if encoding == encodingBase64 {
+			return nil
+		}
+		return fmt.Errorf("firmware %s does not list the message encodings it accepts, so it only takes base64, not %s", info.Version, encoding)
+	}
+	for _, e := range strings.Split(accepted, ",") {
+		if messageEncoding(strings.ToLower(strings.TrimSpace(e))) == encoding {
+			return nil
+		}
+	}
+	return fmt.Errorf("firmware %s expects %s messages, not %s", info.Version, accepted, encoding)
+}
+
+// errRejected is returned when the user declines to sign on the device.
+var errRejected = errors.New("signing rejected on the ESP32")
+
+// errStepTimeout is wrapped by the error returned when the watchdog fires.
+var errStepTimeout = errors.New("watchdog")
+
+// serialPort is what the signer needs from a serial port. *serial.Port
+// implements it, and tests substitute an in-memory port.
+type serialPort interface {
+	io.ReadWriter
+	// Flush discards data written but not transmitted and data received but
+	// not read.
+	Flush() error
+	Close() error
+}
+
+// ESP32Signer is an open serial session with the ESP32. All responses are read
+// through a single buffered reader so bytes are never lost between steps.
+type ESP32Signer struct {
+	port   serialPort
+	reader *bufio.Reader
+	// drain, when set, blocks until the bytes written to port have left
+	// the serial line, not just entered the kernel buffer.
+	drain       func() error
+	closeDrain  func() error
+	stepTimeout time.Duration
+	// signTimeout replaces stepTimeout for the signature request, whose
+	// answer waits for the user to press the button.
+	signTimeout time.Duration
+	// writeTimeout caps how long sending a signing request may take.
+	writeTimeout time.Duration
+	// firmware caches the handshake response once it has been requested.
+	firmware *firmwareInfo
+	// skipPinCheck is set by the firmware command, which re-pins a device
+	// and must not be blocked by its outdated pin.
+	skipPinCheck bool
+	// timer, when set, records the time spent in each protocol phase.
+	timer *phaseTimer
+	// out receives the progress messages of the session.
+	out io.Writer
+}
+
+// openESP32 opens the serial port selected by the global flags.
+func openESP32() (*ESP32Signer, error) {
+	return openESP32Port(*serialPortName)
+}
+
+// openESP32Port opens the device on the named serial port with the global
+// baud rate and step timeout.
+func openESP32Port(name string) (*ESP32Signer, error) {
+	serialConfig := &serial.Config{
+		Name:        name,
+		Baud:        *baudRate,
+		ReadTimeout: time.Second * 1,
+	}
+	port, err := serial.OpenPort(serialConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error opening serial port: %w", err)
+	}
+	s := newESP32Signer(port)
+	if tty, err := openDrain(name); err == nil {
+		s.drain = func() error { return tcdrain(tty) }
+		s.closeDrain = tty.Close
+	}
+	return s, nil
+}
+
+// newESP32Signer starts a session on an open port with the global timeouts.
+func newESP32Signer(port serialPort) *ESP32Signer {
+	return &ESP32Signer{
+		port:         port,
+		reader:       bufio.NewReader(port),
+		stepTimeout:  *stepTimeout,
+		signTimeout:  *signTimeout,
+		writeTimeout: *writeTimeout,
+		out:          os.Stdout,
+	}
+}
+
+// Close closes the serial port.
+func (s *ESP32Signer) Close() error {
+	if s.closeDrain != nil {
+		s.closeDrain()
+	}
+	return s.port.Close()
+}
+
+// writeTimed writes data to the port and waits until it has been
+// transmitted, failing if that takes longer than the write timeout. This
+// tells a slow or stalled link apart from a device that is slow to sign. On
+// platforms without tcdrain only the hand-off to the kernel is timed.
+func (s *ESP32Signer) writeTimed(step string, data []byte) error {
+	started := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.port.Write(data)
+		if err == nil && s.drain != nil {
+			err = s.drain()
+		}
+		done <- err
+	}()
+	var timeout <-chan time.Time
+	if s.writeTimeout > 0 {
+		timer := time.NewTimer(s.writeTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			return err
+		}
+	case <-timeout:
+		// Discard the queued output until the blocked write and drain
+		// return, so the writer does not outlive the request.
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		for waiting := true; waiting; {
+			s.port.Flush()
+			select {
+			case <-done:
+				waiting = false
+			case <-ticker.C:
+			}
+		}
+		return fmt.Errorf("%w: sending %d bytes for %s took longer than %s; the serial link is too slow or stalled", errStepTimeout, len(data), step, s.writeTimeout)
+	}
+	if *verbose {
+		elapsed := time.Since(started)
+		rate := float64(len(data)) / elapsed.Seconds()
+		what := "Sent"
+		if s.drain == nil {
+			what = "Queued"
+		}
+		fmt.Fprintf(s.out, "%s %d bytes in %s (%.0f bytes/s)\n", what, len(data), elapsed.Round(time.Microsecond), rate)
+	}
+	return nil
+}
+
+// readLine waits for the response to a protocol step. If no complete line
+// arrives before the step timeout the watchdog fires: the port buffers are
+// flushed so a late reply cannot be mistaken for the answer to a later step,
+// and an error naming the step is returned.
+func (s *ESP32Signer) readLine(step string) (string, error) {
+	return s.readLineWithin(step, s.stepTimeout)
+}
+
+// readLineWithin is readLine with its own timeout.
+func (s *ESP32Signer) readLineWithin(step string, timeout time.Duration) (string, error) {
+	deadline := time.Now().Add(timeout)
+	// The port read timeout is much shorter than a step, so a firmware that
+	// trickles its answer out is read in pieces that are joined here.
+	var line strings.Builder
+	for {
+		chunk, err := s.reader.ReadString('\n')
+		line.WriteString(chunk)
+		if err == nil {
+			return cleanResponseLine(line.String())
+		}
+		if line.Len() > MAX_RESPONSE_LINE {
+			s.reader.Reset(s.port)
+			s.port.Flush()
+			return "", fmt.Errorf("ESP32 answer to %s ran past %d bytes without a line end", step, MAX_RESPONSE_LINE)
+		}
+		if err := checkDeadline(step); err != nil {
+			s.reader.Reset(s.port)
+			s.port.Flush()
+			return "", err
+		}
+		if time.Now().After(deadline) {
+			s.reader.Reset(s.port)
+			s.port.Flush()
+			return "", fmt.Errorf("%w: ESP32 did not answer %s within %s", errStepTimeout, step, timeout)
+		}
+		if chunk == "" {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+}
+
+// cleanResponseLine trims a raw response line and rejects anything that is not
+// printable ASCII, so line noise or a confused firmware produces a clean error
+// instead of garbage being decoded further.
+func cleanResponseLine(line string) (string, error) {
+	if len(line) > MAX_RESPONSE_LINE {
+		return "", fmt.Errorf("ESP32 response is %d bytes, longer than %d", len(line), MAX_RESPONSE_LINE)
+	}
+	line = strings.Trim(line, " \t\r\n\x00")
+	for i := 0; i < len(line); i++ {
+		if c := line[i]; c < 0x20 || c > 0x7e {
+			return "", fmt.Errorf("ESP32 response has unexpected byte 0x%02x at offset %d", c, i)
+		}
+	}
+	return line, nil
+}
+
+// parsePubkeyResponse decodes the answer to GET_PUBKEY, rejecting keys a
+// working device cannot hold.
+func parsePubkeyResponse(line string) (solana.PublicKey, error) {
+	if line == "" {
+		return solana.PublicKey{}, fmt.Errorf("no public key received from ESP32")
+	}
+	pubkey, err := solana.PublicKeyFromBase58(line)
+	if err != nil {
+		return solana.PublicKey{}, fmt.Errorf("invalid public key from ESP32: %w", err)
+	}
+	// An uninitialized device or a firmware bug can report a placeholder key
+	// that no private key signs for; funds sent to it would be lost.
+	if pubkey.IsZero() {
+		return solana.PublicKey{}, fmt.Errorf("ESP32 reported the all-zero public key; the device does not seem to be initialized")
+	}
+	if !solana.IsOnCurve(pubkey[:]) {
+		return solana.PublicKey{}, fmt.Errorf("ESP32 reported %s, which is not a valid ed25519 public key; the device does not seem to be initialized", pubkey)
+	}
+	return pubkey, nil
+}
+
+// parseSignatureResponse decodes a base64 signature sent by the ESP32.
+func parseSignatureResponse(line string) (solana.Signature, error) {
+	sigBytes, err := base64.StdEncoding.DecodeString(line)
+	if err != nil {
+		return solana.Signature{}, fmt.Errorf("error decoding signature: %w", err)
+	}
+	if len(sigBytes) != solana.SignatureLength {
+		return solana.Signature{}, fmt.Errorf("signature has %d bytes, expected %d", len(sigBytes), solana.SignatureLength)
+	}
+	var signature solana.Signature
+	copy(signature[:], sigBytes)
+	return signature, nil
+}
+
+// getESP32PublicKey writes "GET_PUBKEY\n" to the serial port, reads the public key string,
+// and converts it to a solana.PublicKey.
+func getESP32PublicKey(signer *ESP32Signer) (solana.PublicKey, error) {
+	command := "GET_PUBKEY\n"
+	_, err := signer.port.Write([]byte(command))
+	if err != nil {
+		return solana.PublicKey{}, err
+	}
+	fmt.Fprintln(signer.out, "Requested public key from ESP32")
+
+	pubkeyStr, err := signer.readLine("GET_PUBKEY")
+	if err != nil {
+		return solana.PublicKey{}, err
+	}
+	fmt.Fprintln(signer.out, "Received ESP32 public key:", pubkeyStr)
+	pubkey, err := parsePubkeyResponse(pubkeyStr)
+	if err != nil {
+		return solana.PublicKey{}, err
+	}
+	if err := checkExpectedPubkey(pubkey); err != nil {
+		return solana.PublicKey{}, err
+	}
+	if !signer.skipPinCheck {
+		if err := checkFirmwarePin(signer, pubkey); err != nil {
+			return solana.PublicKey{}, err
+		}
+	}
+	return pubkey, nil
+}
+
+// sendToESP32AndGetSignature sends an encoded message over the serial port
+// and waits for a base64-encoded signature response.
+func sendToESP32AndGetSignature(signer *ESP32Signer, message string) (string, error) {
+	fullMessage := message + "\n"
+	if err := signer.writeTimed("signature request", []byte(fullMessage)); err != nil {
+		return "", err
+	}
+	fmt.Fprintln(signer.out, "Sent to ESP32:", message)
+
+	sigStr, err := signer.readLineWithin("signature request", signer.signTimeout)
+	if err != nil {
+		return "", err
+	}
+	if sigStr == "" {
+		return "", fmt.Errorf("no signature received from ESP32")
+	}
+	if sigStr == "REJECTED" {
+		return "", errRejected
+	}
+	fmt.Fprintln(signer.out, "Received signature from ESP32:", sigStr)
+	return sigStr, nil
+}
+
+// signMessageWithESP32 sends the serialized message to the ESP32 and returns the
+// decoded signature it produced. With -blockhash-echo the message is sent as
+// "ECHO:<message>" and the device answers "<signature>;blockhash=<base58>"; the
+// echoed blockhash must match the one in msgBytes.
+func signMessageWithESP32(signer *ESP32Signer, msgBytes []byte) (solana.Signature, error) {
+	if err := dumpPayload(signer.out, msgBytes); err != nil {
+		return solana.Signature{}, err
+	}
+	message := encodeMessage(msgBytes, outgoingEncoding)
+	fmt.Fprintf(signer.out, "Serialized Transaction Message (%s): %s\n", outgoingEncoding, message)
+
+	// Only non-default encodings justify a handshake, which costs a step
+	// timeout on legacy firmware; base64 is checked when it was done anyway.
+	if outgoingEncoding != encodingBase64 || signer.firmware != nil {
+		info, err := signer.handshake()
+		if err != nil {
+			return solana.Signature{}, err
+		}
+		if err := checkMessageEncoding(info, outgoingEncoding); err != nil {
+			return solana.Signature{}, err
+		}
+	}
+
+	request := message
+	if *blockhashEcho {
+		info, err := signer.handshake()
+		if err != nil {
+			return solana.Signature{}, err
+		}
+		if !info.hasCapability(CAP_BLOCKHASH_ECHO) {
+			return solana.Signature{}, fmt.Errorf("firmware %s does not support %s", info.Version, CAP_BLOCKHASH_ECHO)
+		}
+		request = "ECHO:" + message
+	}
+	if *sendLookups {
+		prefix, err := lookupRequestPrefix(signer, msgBytes)
+		if err != nil {
+			return solana.Signature{}, err
+		}
+		request = prefix + request
+	}
+
+	response, err := sendToESP32AndGetSignature(signer, request)
+	if err != nil {
+		return solana.Signature{}, err
+	}
+	base64Signature := response
+	if *blockhashEcho {
+		if err := verifyBlockhashEcho(signer.out, msgBytes, response); err != nil {
+			return solana.Signature{}, err
+		}
+		base64Signature, _, _ = strings.Cut(response, ";")
+	}
+
+	return parseSignatureResponse(base64Signature)
+}
+
+// verifyBlockhashEcho checks that the blockhash echoed in response is the one
+// in the message the host sent, which would not hold if the message was
+// altered on the way to the device.
+func verifyBlockhashEcho(out io.Writer, msgBytes []byte, response string) error {
+	var msg solana.Message
+	if err := msg.UnmarshalWithDecoder(bin.NewBinDecoder(msgBytes)); err != nil {
+		return fmt.Errorf("error decoding message: %w", err)
+	}
+	_, echo, ok := strings.Cut(response, ";blockhash=")
+	if !ok {
+		return fmt.Errorf("ESP32 did not echo the blockhash it signed")
+	}
+	echoed, err := solana.HashFromBase58(strings.TrimSpace(echo))
+	if err != nil {
+		return fmt.Errorf("error decoding echoed blockhash: %w", err)
+	}
+	if !echoed.Equals(msg.RecentBlockhash) {
+		return fmt.Errorf("aborting: ESP32 signed blockhash %s but the transaction uses %s", echoed, msg.RecentBlockhash)
+	}
+	fmt.Fprintln(out, "ESP32 confirmed blockhash:", echoed)
+	return nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// fakePort is an in-memory serialPort. Reads hand out at most chunk bytes of
+// the scripted input at a time and report io.EOF when nothing is pending, as
+// a real port does when its read timeout passes.
+type fakePort struct {
+	mu      sync.Mutex
+	input   []byte
+	chunk   int
+	written bytes.Buffer
+	flushes int
+}
+
+func (p *fakePort) Read(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.input) == 0 {
+		return 0, io.EOF
+	}
+	n := len(p.input)
+	if p.chunk > 0 && n > p.chunk {
+		n = p.chunk
+	}
+	n = copy(b, p.input[:n])
+	p.input = p.input[n:]
+	return n, nil
+}
+
+func (p *fakePort) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.written.Write(b)
+}
+
+func (p *fakePort) Flush() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.flushes++
+	return nil
+}
+
+func (p *fakePort) Close() error { return nil }
+
+func TestReadLineJoinsTrickledBytes(t *testing.T) {
+	const sig = "xksm1PMfnTKj2mhvOWsBMjS2j9NqCPU+Ej7lGx8cCO0Tdaxb4OqVtHgTHSgvovrkRwE3bbVlfdmdonPLEgvcCA=="
+	port := &fakePort{input: []byte(sig + "\r\n"), chunk: 1}
+	s := newESP32Signer(port)
+	s.stepTimeout = 5 * time.Second
+
+	got, err := s.readLine("signature request")
+	if err != nil {
+		t.Fatalf("readLine: %v", err)
+	}
+	if got != sig {
+		t.Fatalf("readLine = %q, want %q", got, sig)
+	}
+}
+
+func TestReadLineRejectsOverlongLine(t *testing.T) {
+	port := &fakePort{input: []byte(strings.Repeat("A", MAX_RESPONSE_LINE+10)), chunk: 64}
+	s := newESP32Signer(port)
+	s.stepTimeout = 5 * time.Second
+
+	_, err := s.readLine("signature request")
+	if err == nil || !strings.Contains(err.Error(), "signature request") {
+		t.Fatalf("readLine error = %v, want one naming the step", err)
+	}
+	if port.flushes == 0 {
+		t.Fatal("port was not flushed after the overlong line")
+	}
+}
+
+func TestReadLineTimesOut(t *testing.T) {
+	port := &fakePort{input: []byte("partial")}
+	s := newESP32Signer(port)
+	s.stepTimeout = 150 * time.Millisecond
+
+	_, err := s.readLine("GET_PUBKEY")
+	if !errors.Is(err, errStepTimeout) {
+		t.Fatalf("readLine error = %v, want errStepTimeout", err)
+	}
+}
+
+func FuzzParseResponse(f *testing.F) {
+	f.Add([]byte("AKnL4NNf3DGWZJS6cPknBuEGnVsV4A4m5tgebLHaRSZ9\r\n"))
+	f.Add([]byte("xksm1PMfnTKj2mhvOWsBMjS2j9NqCPU+Ej7lGx8cCO0Tdaxb4OqVtHgTHSgvovrkRwE3bbVlfdmdonPLEgvcCA==\n"))
+	f.Add([]byte("xksm1PMfnTKj2mhvOWsBMjS2j9NqCPU+Ej7l\n"))
+	f.Add([]byte("AKnL4NNf3DGWZJS6cPknBuEGnV\n"))
+	f.Add([]byte("sig\xff\xfe\x00n\xc3\xa9\n"))
+	f.Add([]byte(strings.Repeat("A", MAX_RESPONSE_LINE+1) + "\n"))
+	f.Add([]byte(""))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		port := &fakePort{input: append(append([]byte{}, data...), '\n'), chunk: 7}
+		s := newESP32Signer(port)
+		s.stepTimeout = time.Second
+		line, err := s.readLine("fuzz")
+		if err != nil {
+			return
+		}
+		if len(line) > MAX_RESPONSE_LINE {
+			t.Fatalf("accepted a %d byte line", len(line))
+		}
+		for i := 0; i < len(line); i++ {
+			if c := line[i]; c < 0x20 || c > 0x7e {
+				t.Fatalf("accepted byte 0x%02x at offset %d", c, i)
+			}
+		}
+		parsePubkeyResponse(line)
+		parseSignatureResponse(line)
+	})
+}
+
+func TestParsePubkeyResponse(t *testing.T) {
+	offCurve, _, err := solana.FindProgramAddress([][]byte{[]byte("off-curve")}, solana.SystemProgramID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		line    string
+		wantErr bool
+	}{
+		{"valid key", "AKnL4NNf3DGWZJS6cPknBuEGnVsV4A4m5tgebLHaRSZ9", false},
+		{"all-zero key", "11111111111111111111111111111111", true},
+		{"off-curve key", offCurve.String(), true},
+		{"empty", "", true},
+		{"not base58", "not-a-key!", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := parsePubkeyResponse(tt.line)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parsePubkeyResponse(%q) = %s, want an error", tt.line, key)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsePubkeyResponse(%q): %v", tt.line, err)
+			}
+			if key.String() != tt.line {
+				t.Fatalf("parsePubkeyResponse(%q) = %s", tt.line, key)
+			}
+		})
+	}
+}
+
+func TestCheckMessageEncoding(t *testing.T) {
+	tests := []struct {
+		name      string
+		handshake string
+		encoding  messageEncoding
+		wantErr   bool
+	}{
+		{"no enc field, base64", "HANDSHAKE:version=1.0.0", encodingBase64, false},
+		{"no enc field, base58", "HANDSHAKE:version=1.0.0", encodingBase58, true},
+		{"listed", "HANDSHAKE:version=1.2.0;enc=base64, base58", encodingBase58, false},
+		{"not listed", "HANDSHAKE:version=1.2.0;enc=base64", encodingBase58, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, ok := parseHandshake(tt.handshake)
+			if !ok {
+				t.Fatalf("parseHandshake(%q) failed", tt.handshake)
+			}
+			err := checkMessageEncoding(info, tt.encoding)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("checkMessageEncoding(%s) = %v, want error %v", tt.encoding, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// stalledPort is a port whose writes block until the output is flushed, as
+// on a link that stopped accepting data.
+type stalledPort struct {
+	fakePort
+	flushed chan struct{}
+	once    sync.Once
+}
+
+func (p *stalledPort) Write(b []byte) (int, error) {
+	<-p.flushed
+	return 0, errors.New("output discarded")
+}
+
+func (p *stalledPort) Flush() error {
+	p.once.Do(func() { close(p.flushed) })
+	return nil
+}
+
+func TestWriteTimedStalledLink(t *testing.T) {
+	port := &stalledPort{flushed: make(chan struct{})}
+	s := newESP32Signer(port)
+	s.writeTimeout = 50 * time.Millisecond
+
+	err := s.writeTimed("signature request", []byte("message\n"))
+	if !errors.Is(err, errStepTimeout) {
+		t.Fatalf("writeTimed error = %v, want errStepTimeout", err)
+	}
+	select {
+	case <-port.flushed:
+	default:
+		t.Fatal("writeTimed returned without unblocking the writer")
+	}
+}
+
+func TestSignatureRequestUsesSignTimeout(t *testing.T) {
+	s := newESP32Signer(&fakePort{})
+	s.stepTimeout = 10 * time.Millisecond
+	s.signTimeout = 300 * time.Millisecond
+
+	start := time.Now()
+	_, err := sendToESP32AndGetSignature(s, "message")
+	if !errors.Is(err, errStepTimeout) {
+		t.Fatalf("sendToESP32AndGetSignature error = %v, want errStepTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed < s.signTimeout {
+		t.Fatalf("gave up after %s, before the %s sign timeout", elapsed, s.signTimeout)
+	}
+}
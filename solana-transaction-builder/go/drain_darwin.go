@@ -0,0 +1,13 @@
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// tcdrain blocks until everything written to the terminal f belongs to has
+// been transmitted.
+func tcdrain(f *os.File) error {
+	return unix.IoctlSetInt(int(f.Fd()), unix.TIOCDRAIN, 0)
+}
@@ -0,0 +1,18 @@
+//go:build !linux && !darwin
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// openDrain fails on platforms without tcdrain, where writes are only timed
+// until the operating system accepts them.
+func openDrain(name string) (*os.File, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func tcdrain(f *os.File) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,22 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// openDrain opens a second descriptor on the terminal at name for tcdrain,
+// since tarm/serial does not expose its own.
+func openDrain(name string) (*os.File, error) {
+	tty, err := os.OpenFile(name, os.O_RDWR|syscall.O_NOCTTY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := tcdrain(tty); err != nil {
+		tty.Close()
+		return nil, err
+	}
+	return tty, nil
+}
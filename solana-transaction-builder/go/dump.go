@@ -0,0 +1,68 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// DUMP_BYTES_PER_LINE is how many payload bytes each hex line of a
+// -dump-signing-payload file holds.
+const DUMP_BYTES_PER_LINE = 32
+
+var dumpSigningPayload = flag.String("dump-signing-payload", "", "write the exact bytes sent to the ESP32 for signing to this file as hex, with their SHA-256")
+
+// dumpedPayloads counts the payloads written this run; the first truncates
+// the file so it never mixes runs.
+var dumpedPayloads struct {
+	sync.Mutex
+	n int
+}
+
+// formatSigningPayload renders payload as a hex dump headed by its length and
+// SHA-256 hash.
+func formatSigningPayload(payload []byte) string {
+	sum := sha256.Sum256(payload)
+	var b strings.Builder
+	fmt.Fprintf(&b, "# sha256: %s\n", hex.EncodeToString(sum[:]))
+	fmt.Fprintf(&b, "# length: %d bytes\n", len(payload))
+	for i := 0; i < len(payload); i += DUMP_BYTES_PER_LINE {
+		end := min(i+DUMP_BYTES_PER_LINE, len(payload))
+		b.WriteString(hex.EncodeToString(payload[i:end]))
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// dumpPayload writes payload to the -dump-signing-payload file, if set, and
+// reports that on out. Later payloads of the same run, such as further sweep
+// batches, are appended.
+func dumpPayload(out io.Writer, payload []byte) error {
+	if *dumpSigningPayload == "" {
+		return nil
+	}
+	dumpedPayloads.Lock()
+	defer dumpedPayloads.Unlock()
+	mode := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	text := formatSigningPayload(payload)
+	if dumpedPayloads.n > 0 {
+		mode = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		text = "\n" + text
+	}
+	f, err := os.OpenFile(*dumpSigningPayload, mode, 0o600)
+	if err != nil {
+		return fmt.Errorf("error writing signing payload: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(text); err != nil {
+		return fmt.Errorf("error writing signing payload: %w", err)
+	}
+	dumpedPayloads.n++
+	fmt.Fprintln(out, "Wrote signing payload to", *dumpSigningPayload)
+	return nil
+}
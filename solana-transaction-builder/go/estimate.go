@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// CU_ESTIMATE_MARGIN is the headroom added on top of the simulated compute
+// units when deriving a limit, in percent.
+const CU_ESTIMATE_MARGIN = 10
+
+// simulateUnsigned simulates tx without checking signatures, so it need not be
+// signed yet. With replaceBlockhash the node substitutes its latest blockhash.
+func simulateUnsigned(client *rpc.Client, tx *solana.Transaction, replaceBlockhash bool) (*rpc.SimulateTransactionResponse, error) {
+	sim := *tx
+	sim.Signatures = make([]solana.Signature, tx.Message.Header.NumRequiredSignatures)
+	ctx, cancel := withOperationDeadline(context.Background())
+	defer cancel()
+	resp, err := client.SimulateTransactionWithOpts(ctx, &sim, &rpc.SimulateTransactionOpts{
+		ReplaceRecentBlockhash: replaceBlockhash,
+		Commitment:             rpc.CommitmentConfirmed,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error simulating transaction: %w", err)
+	}
+	return resp, nil
+}
+
+// simulateComputeUnits simulates tx, which need not be signed, and returns the
+// compute units it consumed.
+func simulateComputeUnits(client *rpc.Client, tx *solana.Transaction) (uint64, error) {
+	resp, err := simulateUnsigned(client, tx, true)
+	if err != nil {
+		return 0, err
+	}
+	if resp.Value.Err != nil {
+		return 0, fmt.Errorf("simulation failed: %v", resp.Value.Err)
+	}
+	if resp.Value.UnitsConsumed == nil {
+		return 0, fmt.Errorf("simulation did not report compute units")
+	}
+	return *resp.Value.UnitsConsumed, nil
+}
+
+// estimatedLimit returns the compute unit limit to request for a transaction
+// that consumed units in simulation.
+func estimatedLimit(units uint64) uint32 {
+	limit := units + units*CU_ESTIMATE_MARGIN/100
+	if limit > MAX_COMPUTE_UNITS {
+		limit = MAX_COMPUTE_UNITS
+	}
+	return uint32(limit)
+}
+
+// checkComputeBudget handles a transfer that sets a priority fee but no
+// compute unit limit. The fee is charged on the whole default limit, so with
+// auto the limit is derived by simulating tx and a rebuilt transaction is
+// returned; otherwise a warning is printed and tx is returned as is.
+func checkComputeBudget(out io.Writer, client *rpc.Client, params *transferParams, tx *solana.Transaction, blockhash blockhashInfo, auto bool) (*solana.Transaction, blockhashInfo, error) {
+	if params.ComputeUnitPrice == 0 || params.ComputeUnitLimit > 0 {
+		return tx, blockhash, nil
+	}
+	if !auto {
+		limit, _ := computeUnitLimit(tx)
+		warnTo(out, "-compute-unit-price is set without -compute-unit-limit, so the priority fee is paid on the default limit of %d compute units; run estimate to find a realistic limit", limit)
+		return tx, blockhash, nil
+	}
+	units, err := simulateComputeUnits(client, tx)
+	if err != nil {
+		return nil, blockhashInfo{}, fmt.Errorf("deriving -compute-unit-limit: %w", err)
+	}
+	params.ComputeUnitLimit = estimatedLimit(units)
+	fmt.Fprintf(out, "Simulation used %d compute units; setting the compute unit limit to %d\n", units, params.ComputeUnitLimit)
+	return createUnsignedTransaction(out, client, *params)
+}
+
+// runEstimate simulates a transfer and suggests a compute unit limit for it.
+func runEstimate(args []string) error {
+	fs := flag.NewFlagSet("estimate", flag.ExitOnError)
+	transfer := addTransferFlags(fs)
+	fs.Parse(args)
+
+	client, err := newRPCClient()
+	if err != nil {
+		return err
+	}
+	var device solana.PublicKey
+	if *transfer.from == "" {
+		esp32, err := openESP32()
+		if err != nil {
+			return err
+		}
+		device, err = getESP32PublicKey(esp32)
+		esp32.Close()
+		if err != nil {
+			return fmt.Errorf("error getting ESP32 public key: %w", err)
+		}
+	}
+	params, err := transfer.params(device)
+	if err != nil {
+		return err
+	}
+	tx, _, err := createUnsignedTransaction(os.Stdout, client, params)
+	if err != nil {
+		return fmt.Errorf("error creating transaction: %w", err)
+	}
+	units, err := simulateComputeUnits(client, tx)
+	if err != nil {
+		return err
+	}
+	limit := estimatedLimit(units)
+	current, explicit := computeUnitLimit(tx)
+	source := "default"
+	if explicit {
+		source = "set"
+	}
+	fmt.Printf("Compute units consumed: %d (%s limit %d)\n", units, source, current)
+	fmt.Printf("Suggested -compute-unit-limit: %d\n", limit)
+	if params.ComputeUnitPrice > 0 {
+		fmt.Printf("Priority fee at %d micro-lamports per unit: %s with the suggested limit, %s with the %s limit\n",
+			params.ComputeUnitPrice, formatAmount(priorityFee(params.ComputeUnitPrice, limit)), formatAmount(priorityFee(params.ComputeUnitPrice, current)), source)
+	}
+	return nil
+}
+
+// priorityFee is the priority fee in lamports for price micro-lamports per
+// compute unit over limit units, rounded up.
+func priorityFee(price uint64, limit uint32) uint64 {
+	return (price*uint64(limit) + 999_999) / 1_000_000
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// FIRMWARE_PINS_FILE maps device public keys to the firmware version last
+// accepted for them.
+const FIRMWARE_PINS_FILE = "firmware_pins.json"
+
+// CAP_BLOCKHASH_ECHO is advertised by firmware that can echo the blockhash
+// of the message it signed.
+const CAP_BLOCKHASH_ECHO = "blockhash-echo"
+
+var blockhashEcho = flag.Bool("blockhash-echo", false, "have the ESP32 echo the blockhash it signed and abort if it differs (needs firmware support)")
+
+// firmwareInfo is what the device reports in its handshake. Firmware that
+// predates the handshake reports version "unknown" and no capabilities.
+type firmwareInfo struct {
+	Version      string
+	Capabilities []string
+	// Fields holds every key=value pair of the handshake response.
+	Fields map[string]string
+}
+
+// hasCapability reports whether the firmware advertised capability name.
+func (f firmwareInfo) hasCapability(name string) bool {
+	for _, c := range f.Capabilities {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseHandshake parses a "HANDSHAKE:version=1.2.0;caps=a,b" response.
+func parseHandshake(line string) (firmwareInfo, bool) {
+	rest, ok := strings.CutPrefix(line, "HANDSHAKE:")
+	if !ok {
+		return firmwareInfo{}, false
+	}
+	info := firmwareInfo{Version: "unknown", Fields: map[string]string{}}
+	for _, field := range strings.Split(rest, ";") {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		info.Fields[key] = value
+		switch key {
+		case "version":
+			info.Version = value
+		case "caps":
+			for _, c := range strings.Split(value, ",") {
+				if c = strings.TrimSpace(c); c != "" {
+					info.Capabilities = append(info.Capabilities, c)
+				}
+			}
+		}
+	}
+	return info, true
+}
+
+// handshake asks the device for its firmware version and capabilities. The
+// result is cached for the lifetime of the session.
+func (s *ESP32Signer) handshake() (firmwareInfo, error) {
+	if s.firmware != nil {
+		return *s.firmware, nil
+	}
+	resume := s.timer.phase()
+	s.timer.begin(PHASE_HANDSHAKE)
+	defer s.timer.begin(resume)
+	if _, err := s.port.Write([]byte("HANDSHAKE\n")); err != nil {
+		return firmwareInfo{}, err
+	}
+	info := firmwareInfo{Version: "unknown", Fields: map[string]string{}}
+	line, err := s.readLine("HANDSHAKE")
+	if err == nil {
+		if parsed, ok := parseHandshake(line); ok {
+			info = parsed
+		}
+	}
+	// Firmware without handshake support either stays silent or answers
+	// with something else; both mean a legacy device, not a failure.
+	s.firmware = &info
+	return info, nil
+}
+
+// checkFirmwarePin compares the firmware of the device holding devicePubkey
+// with the version pinned for it. On a mismatch the user must confirm before
+// continuing, and the new version is pinned once they do.
+func checkFirmwarePin(esp32 *ESP32Signer, devicePubkey solana.PublicKey) error {
+	pins := map[string]string{}
+	if err := loadConfigFile(FIRMWARE_PINS_FILE, &pins); err != nil {
+		return err
+	}
+	pinned, ok := pins[devicePubkey.String()]
+	if !ok {
+		return nil
+	}
+	info, err := esp32.handshake()
+	if err != nil {
+		return err
+	}
+	if info.Version == pinned {
+		return nil
+	}
+
+	fmt.Fprintln(os.Stderr, "!!! WARNING: FIRMWARE VERSION CHANGED !!!")
+	fmt.Fprintf(os.Stderr, "Device %s was pinned to firmware %s but reports %s.\n", devicePubkey, pinned, info.Version)
+	fmt.Fprintln(os.Stderr, "Re-verify the device before trusting it with funds.")
+	fmt.Fprint(os.Stderr, "Continue and pin the new version? [y/N] ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+		return fmt.Errorf("aborted: firmware %s does not match pinned %s", info.Version, pinned)
+	}
+	pins[devicePubkey.String()] = info.Version
+	return saveConfigFile(FIRMWARE_PINS_FILE, pins)
+}
+
+// runFirmware shows the connected device's firmware and optionally pins it.
+func runFirmware(args []string) error {
+	fs := flag.NewFlagSet("firmware", flag.ExitOnError)
+	pin := fs.Bool("pin", false, "record the reported version as the expected firmware for this device")
+	fs.Parse(args)
+
+	esp32, err := openESP32()
+	if err != nil {
+		return err
+	}
+	defer esp32.Close()
+	esp32.skipPinCheck = true
+
+	esp32Pubkey, err := getESP32PublicKey(esp32)
+	if err != nil {
+		return fmt.Errorf("error getting ESP32 public key: %w", err)
+	}
+	info, err := esp32.handshake()
+	if err != nil {
+		return err
+	}
+	fmt.Println("Firmware version:", info.Version)
+	fmt.Println("Capabilities:", strings.Join(info.Capabilities, ", "))
+
+	if *pin {
+		pins := map[string]string{}
+		if err := loadConfigFile(FIRMWARE_PINS_FILE, &pins); err != nil {
+			return err
+		}
+		pins[esp32Pubkey.String()] = info.Version
+		if err := saveConfigFile(FIRMWARE_PINS_FILE, pins); err != nil {
+			return err
+		}
+		fmt.Printf("Pinned firmware %s for %s\n", info.Version, esp32Pubkey)
+	}
+	return nil
+}
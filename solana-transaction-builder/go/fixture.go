@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/programs/system"
+)
+
+// Inputs of the canonical transfer fixture. The blockhash is the same const
+// nonce the firmware uses for its placeholder transactions, so host and device
+// implementations can be compared byte for byte.
+const (
+	FIXTURE_BLOCKHASH = "11111111111111111111111111111112"
+	FIXTURE_LAMPORTS  = 1000000
+	FIXTURE_GOLDEN    = "testdata/transfer_fixture.golden"
+)
+
+// fixtureSourceKey is the deterministic key pair that funds the fixture
+// transfer: the ed25519 key generated from a seed of 32 0x01 bytes.
+func fixtureSourceKey() solana.PrivateKey {
+	return solana.PrivateKey(ed25519.NewKeyFromSeed(bytes.Repeat([]byte{1}, ed25519.SeedSize)))
+}
+
+// buildFixtureTransaction builds the canonical transfer fixture and signs it
+// with fixtureSourceKey.
+func buildFixtureTransaction() (*solana.Transaction, error) {
+	key := fixtureSourceKey()
+	blockhash, err := solana.HashFromBase58(FIXTURE_BLOCKHASH)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := solana.NewTransaction(
+		[]solana.Instruction{
+			system.NewTransferInstruction(FIXTURE_LAMPORTS, key.PublicKey(), solana.MustPublicKeyFromBase58(RECIPIENT_PUBLIC_KEY)).Build(),
+		},
+		blockhash,
+		solana.TransactionPayer(key.PublicKey()),
+	)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Sign(func(pub solana.PublicKey) *solana.PrivateKey {
+		if pub.Equals(key.PublicKey()) {
+			return &key
+		}
+		return nil
+	})
+	return tx, err
+}
+
+// fixtureContents renders the fixture in its golden-file format.
+func fixtureContents(tx *solana.Transaction) (string, error) {
+	signed, err := tx.ToBase64()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("blockhash=%s\nfrom=%s\nto=%s\nlamports=%d\nmessage=%s\ntransaction=%s\n",
+		FIXTURE_BLOCKHASH, fixtureSourceKey().PublicKey(), RECIPIENT_PUBLIC_KEY, FIXTURE_LAMPORTS,
+		tx.Message.ToBase64(), signed), nil
+}
+
+// runFixture writes the canonical transfer fixture, or with -check compares it
+// against the golden file and fails on any difference.
+func runFixture(args []string) error {
+	fs := flag.NewFlagSet("fixture", flag.ExitOnError)
+	out := fs.String("out", "", "file to write the fixture to (default stdout)")
+	check := fs.String("check", "", "golden file to compare against, e.g. "+FIXTURE_GOLDEN)
+	fs.Parse(args)
+
+	tx, err := buildFixtureTransaction()
+	if err != nil {
+		return fmt.Errorf("error building fixture: %w", err)
+	}
+	contents, err := fixtureContents(tx)
+	if err != nil {
+		return err
+	}
+
+	if *check != "" {
+		golden, err := os.ReadFile(*check)
+		if err != nil {
+			return err
+		}
+		if string(golden) != contents {
+			return fmt.Errorf("fixture differs from %s:\n%s", *check, contents)
+		}
+		fmt.Println("Fixture matches", *check)
+		return nil
+	}
+	if *out == "" {
+		fmt.Print(contents)
+		return nil
+	}
+	return os.WriteFile(*out, []byte(contents), 0o644)
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestFixtureMatchesGolden(t *testing.T) {
+	tx, err := buildFixtureTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err := fixtureContents(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden, err := os.ReadFile(FIXTURE_GOLDEN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(golden) != contents {
+		t.Fatalf("fixture differs from %s; if the change is intended, regenerate it with fixture -out %s\ngot:\n%s\nwant:\n%s", FIXTURE_GOLDEN, FIXTURE_GOLDEN, contents, golden)
+	}
+}
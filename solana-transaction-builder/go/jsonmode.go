@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/gagliardetto/solana-go"
+
+	"signer/send"
+)
+
+// MAX_JSON_RECIPIENTS keeps a JSON request within the legacy transaction size
+// limit.
+const MAX_JSON_RECIPIENTS = 20
+
+// jsonRequest is the transaction description read from stdin by the json
+// command.
+type jsonRequest struct {
+	Recipients       []jsonRecipient `json:"recipients"`
+	Memo             string          `json:"memo,omitempty"`
+	ComputeUnitPrice uint64          `json:"computeUnitPrice,omitempty"`
+	ComputeUnitLimit uint32          `json:"computeUnitLimit,omitempty"`
+}
+
+// jsonRecipient is one payment of a jsonRequest.
+type jsonRecipient struct {
+	Address  string `json:"address"`
+	Lamports uint64 `json:"lamports"`
+}
+
+// jsonResult is written to stdout by the json command.
+type jsonResult struct {
+	Status        string `json:"status"`
+	Signature     string `json:"signature,omitempty"`
+	From          string `json:"from,omitempty"`
+	TotalLamports uint64 `json:"totalLamports,omitempty"`
+	Error         string `json:"error,omitempty"`
+	// Warnings are the warnings printed while the request ran.
+	Warnings []string `json:"warnings,omitempty"`
+	// Phases is the time spent in each phase of the operation.
+	Phases []phaseTiming `json:"phases,omitempty"`
+}
+
+// decodeJSONRequest parses and validates a request. Unknown fields, trailing
+// data and missing or zero amounts are all rejected.
+func decodeJSONRequest(r io.Reader) (jsonRequest, error) {
+	var req jsonRequest
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		return req, fmt.Errorf("invalid request: %w", err)
+	}
+	if dec.More() {
+		return req, errors.New("invalid request: trailing data after JSON object")
+	}
+	if len(req.Recipients) == 0 {
+		return req, errors.New("invalid request: recipients must not be empty")
+	}
+	if len(req.Recipients) > MAX_JSON_RECIPIENTS {
+		return req, fmt.Errorf("invalid request: at most %d recipients fit in one transaction", MAX_JSON_RECIPIENTS)
+	}
+	for i, r := range req.Recipients {
+		if _, err := solana.PublicKeyFromBase58(r.Address); err != nil {
+			return req, fmt.Errorf("invalid request: recipients[%d].address: %w", i, err)
+		}
+		if r.Lamports == 0 {
+			return req, fmt.Errorf("invalid request: recipients[%d].lamports must be positive", i)
+		}
+	}
+	return req, nil
+}
+
+// params converts the request into transferParams paid by from.
+func (req jsonRequest) params(from solana.PublicKey) transferParams {
+	p := transferParams{
+		From:             from,
+		FeePayer:         from,
+		Memo:             req.Memo,
+		ComputeUnitPrice: req.ComputeUnitPrice,
+		ComputeUnitLimit: req.ComputeUnitLimit,
+	}
+	for _, r := range req.Recipients {
+		p.Payments = append(p.Payments, payment{Recipient: solana.MustPublicKeyFromBase58(r.Address), Lamports: r.Lamports})
+	}
+	return p
+}
+
+// runJSON reads a jsonRequest from stdin, signs and broadcasts it and writes
+// a jsonResult to stdout. Progress output goes to stderr so stdout carries
+// nothing but the result.
+func runJSON(args []string) error {
+	fs := flag.NewFlagSet("json", flag.ExitOnError)
+	maxTxAge := fs.Duration("max-tx-age", 0, "rebuild and re-sign if more than this passed between building and broadcasting (0 disables)")
+	noDust := fs.Bool("no-dust", false, "refuse transfers smaller than the estimated fee")
+	fs.Parse(args)
+
+	result, err := executeJSONRequest(os.Stdin, sendOptions{maxTxAge: *maxTxAge, noDust: *noDust, out: os.Stderr})
+	if err != nil {
+		result.Status = send.StatusFailed
+		result.Error = err.Error()
+	}
+	enc := json.NewEncoder(os.Stdout)
+	if encErr := enc.Encode(result); encErr != nil {
+		return encErr
+	}
+	return err
+}
+
+// executeJSONRequest performs the request read from r through the send flow,
+// retries included. opts supplies everything but the transfer itself.
+func executeJSONRequest(r io.Reader, opts sendOptions) (result jsonResult, err error) {
+	timer := &phaseTimer{}
+	defer func() { result.Phases = timer.breakdown() }()
+
+	req, err := decodeJSONRequest(r)
+	if err != nil {
+		return result, err
+	}
+	client, err := newRPCClient()
+	if err != nil {
+		return result, err
+	}
+
+	opts.timer = timer
+	opts.params = func(device solana.PublicKey) (transferParams, error) {
+		params := req.params(device)
+		result.From = device.String()
+		result.TotalLamports = params.totalLamports()
+		return params, nil
+	}
+	sent, err := executeSendWithRetries(client, opts)
+	if !sent.Signature.IsZero() {
+		result.Signature = sent.Signature.String()
+	}
+	result.Warnings = sent.Warnings
+	if err != nil {
+		return result, err
+	}
+	result.Status = sent.Status
+	return result, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+
+	"signer/send"
+)
+
+// runTestJSON runs executeJSONRequest for a payment of lamports against the
+// RPC handlers, with progress written to the returned buffer.
+func runTestJSON(t *testing.T, handlers map[string]func([]json.RawMessage) rpcReply, lamports uint64, noDust bool) (*signingPort, *bytes.Buffer, jsonResult, error) {
+	t.Helper()
+	oldRPC, oldWS := *rpcURL, *wsURL
+	*rpcURL, *wsURL = fakeRPCURL(t, handlers), ""
+	t.Cleanup(func() { *rpcURL, *wsURL = oldRPC, oldWS })
+
+	request := fmt.Sprintf(`{"recipients":[{"address":%q,"lamports":%d}]}`, solana.NewWallet().PublicKey(), lamports)
+	port := &signingPort{key: solana.NewWallet().PrivateKey}
+	var out bytes.Buffer
+	result, err := executeJSONRequest(strings.NewReader(request), sendOptions{noDust: noDust, open: port.open, out: &out})
+	return port, &out, result, err
+}
+
+func TestJSONRequestUsesSendFlow(t *testing.T) {
+	port, out, result, err := runTestJSON(t, chainHandlers(), 1_000_000, false)
+	if err != nil {
+		t.Fatalf("executeJSONRequest: %v", err)
+	}
+	if result.Status != send.StatusConfirmed || result.Signature == "" {
+		t.Fatalf("result = %+v, want a confirmed signature", result)
+	}
+	if result.From != port.key.PublicKey().String() || result.TotalLamports != 1_000_000 {
+		t.Fatalf("result from %s for %d lamports, want the device paying 1000000", result.From, result.TotalLamports)
+	}
+	if len(result.Phases) == 0 {
+		t.Fatal("result carries no phase timings")
+	}
+	if !strings.Contains(out.String(), "Estimated fee") {
+		t.Fatalf("progress written to the writer lacks the transfer summary:\n%s", out)
+	}
+}
+
+func TestJSONRequestRefusesDust(t *testing.T) {
+	port, _, result, err := runTestJSON(t, chainHandlers(), 1000, true)
+	if err == nil || !strings.Contains(err.Error(), "dust") {
+		t.Fatalf("executeJSONRequest error = %v, want a dust refusal", err)
+	}
+	if n := port.signRequests(); n != 0 || result.Signature != "" {
+		t.Fatalf("device was asked to sign %d time(s) for a dust transfer", n)
+	}
+}
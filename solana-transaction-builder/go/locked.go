@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// errDeviceBusy is returned by lockedSigner when its queue is already full.
+var errDeviceBusy = errors.New("device busy: signing queue is full")
+
+// lockedSigner serializes access to an ESP32Signer so concurrent callers,
+// such as the workers of sweep-tokens, queue for the device instead of
+// interleaving commands on the serial line.
+type lockedSigner struct {
+	signer *ESP32Signer
+	// queue holds one token per caller that is active or waiting.
+	queue chan struct{}
+	// device holds a token while a caller talks to the device.
+	device      chan struct{}
+	waitTimeout time.Duration
+}
+
+// newLockedSigner wraps signer, allowing up to queueDepth callers to wait
+// behind the active one for at most waitTimeout each.
+func newLockedSigner(signer *ESP32Signer, queueDepth int, waitTimeout time.Duration) *lockedSigner {
+	return &lockedSigner{
+		signer:      signer,
+		queue:       make(chan struct{}, queueDepth+1),
+		device:      make(chan struct{}, 1),
+		waitTimeout: waitTimeout,
+	}
+}
+
+// acquire waits for exclusive use of the device. The returned function must
+// be called to release it.
+func (l *lockedSigner) acquire(ctx context.Context) (func(), error) {
+	select {
+	case l.queue <- struct{}{}:
+	default:
+		return nil, errDeviceBusy
+	}
+
+	timer := time.NewTimer(l.waitTimeout)
+	defer timer.Stop()
+	select {
+	case l.device <- struct{}{}:
+		return func() {
+			<-l.device
+			<-l.queue
+		}, nil
+	case <-timer.C:
+		<-l.queue
+		return nil, fmt.Errorf("%w: waited %s for the device", errDeviceBusy, l.waitTimeout)
+	case <-ctx.Done():
+		<-l.queue
+		return nil, ctx.Err()
+	}
+}
+
+// do runs fn with exclusive use of the device. Work that must not go stale
+// while queued, such as fetching the blockhash to sign, belongs in fn.
+func (l *lockedSigner) do(ctx context.Context, fn func(signer *ESP32Signer) error) error {
+	release, err := l.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return fn(l.signer)
+}
+
+// signMessage has the device sign msgBytes.
+func (l *lockedSigner) signMessage(ctx context.Context, msgBytes []byte) (sig solana.Signature, err error) {
+	err = l.do(ctx, func(signer *ESP32Signer) error {
+		sig, err = signMessageWithESP32(signer, msgBytes)
+		return err
+	})
+	return sig, err
+}
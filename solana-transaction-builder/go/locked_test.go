@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// answeringPort replies to every signing request with a fixed signature and
+// records a request written while an earlier one is still unanswered, which
+// is what unserialized callers would do to the serial protocol.
+type answeringPort struct {
+	fakePort
+	pending     bool
+	interleaved bool
+	requests    int
+}
+
+func (p *answeringPort) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pending {
+		p.interleaved = true
+	}
+	p.pending = true
+	p.requests++
+	p.input = append(p.input, []byte(base64.StdEncoding.EncodeToString(make([]byte, 64))+"\n")...)
+	return len(b), nil
+}
+
+func (p *answeringPort) Read(b []byte) (int, error) {
+	// Answer slowly so a second caller has every chance to cut in.
+	time.Sleep(time.Millisecond)
+	n, err := p.fakePort.Read(b)
+	p.mu.Lock()
+	if len(p.input) == 0 {
+		p.pending = false
+	}
+	p.mu.Unlock()
+	return n, err
+}
+
+func TestLockedSignerSerializesCallers(t *testing.T) {
+	port := &answeringPort{fakePort: fakePort{chunk: 8}}
+	s := newESP32Signer(port)
+	s.stepTimeout = 5 * time.Second
+	locked := newLockedSigner(s, 1, 5*time.Second)
+
+	const perCaller = 5
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*perCaller)
+	for c := 0; c < 2; c++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perCaller; i++ {
+				if _, err := locked.signMessage(context.Background(), []byte("message")); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("signMessage: %v", err)
+	}
+	if port.interleaved {
+		t.Fatal("a request was written while another was still unanswered")
+	}
+	if port.requests != 2*perCaller {
+		t.Fatalf("device saw %d requests, want %d", port.requests, 2*perCaller)
+	}
+}
+
+func TestLockedSignerQueueFull(t *testing.T) {
+	locked := newLockedSigner(newESP32Signer(&fakePort{}), 0, time.Second)
+	held := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		locked.do(context.Background(), func(*ESP32Signer) error {
+			close(held)
+			<-done
+			return nil
+		})
+	}()
+	<-held
+	defer close(done)
+
+	err := locked.do(context.Background(), func(*ESP32Signer) error { return nil })
+	if !errors.Is(err, errDeviceBusy) {
+		t.Fatalf("do error = %v, want errDeviceBusy", err)
+	}
+}
+
+func TestLockedSignerWaitTimeout(t *testing.T) {
+	locked := newLockedSigner(newESP32Signer(&fakePort{}), 1, 50*time.Millisecond)
+	held := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		locked.do(context.Background(), func(*ESP32Signer) error {
+			close(held)
+			<-done
+			return nil
+		})
+	}()
+	<-held
+	defer close(done)
+
+	err := locked.do(context.Background(), func(*ESP32Signer) error { return nil })
+	if !errors.Is(err, errDeviceBusy) || !strings.Contains(err.Error(), "waited") {
+		t.Fatalf("do error = %v, want a queue timeout", err)
+	}
+}
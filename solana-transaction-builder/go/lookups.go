@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	bin "github.com/gagliardetto/binary"
+	"github.com/gagliardetto/solana-go"
+	addresslookuptable "github.com/gagliardetto/solana-go/programs/address-lookup-table"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// CAP_LOOKUP_ADDRESSES is advertised by firmware that accepts the addresses
+// a v0 message loads from lookup tables alongside the message.
+const CAP_LOOKUP_ADDRESSES = "lookup-addresses"
+
+var sendLookups = flag.Bool("send-lookups", false, "resolve the lookup tables of v0 transactions and send the loaded addresses to the ESP32 for display (needs firmware support)")
+
+// resolveLookupAddresses returns the addresses msg loads from lookup tables,
+// in the order the runtime appends them to the account keys: every writable
+// address of every table, then every readonly one.
+func resolveLookupAddresses(ctx context.Context, client *rpc.Client, msg *solana.Message) (solana.PublicKeySlice, error) {
+	lookups := msg.GetAddressTableLookups()
+	var writable, readonly solana.PublicKeySlice
+	for _, lookup := range lookups {
+		table, err := addresslookuptable.GetAddressLookupTable(ctx, client, lookup.AccountKey)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching lookup table %s: %w", lookup.AccountKey, err)
+		}
+		pick := func(indexes solana.Uint8SliceAsNum) (solana.PublicKeySlice, error) {
+			var keys solana.PublicKeySlice
+			for _, i := range indexes {
+				if int(i) >= len(table.Addresses) {
+					return nil, fmt.Errorf("lookup table %s has %d addresses, index %d is out of range", lookup.AccountKey, len(table.Addresses), i)
+				}
+				keys = append(keys, table.Addresses[i])
+			}
+			return keys, nil
+		}
+		w, err := pick(lookup.WritableIndexes)
+		if err != nil {
+			return nil, err
+		}
+		r, err := pick(lookup.ReadonlyIndexes)
+		if err != nil {
+			return nil, err
+		}
+		writable = append(writable, w...)
+		readonly = append(readonly, r...)
+	}
+	return append(writable, readonly...), nil
+}
+
+// lookupRequestPrefix returns the "ALT:<address>,...:" prefix that carries
+// the loaded addresses of msgBytes to the device, or "" when the message
+// loads none.
+func lookupRequestPrefix(signer *ESP32Signer, msgBytes []byte) (string, error) {
+	var msg solana.Message
+	if err := msg.UnmarshalWithDecoder(bin.NewBinDecoder(msgBytes)); err != nil {
+		return "", fmt.Errorf("error decoding message: %w", err)
+	}
+	if !msg.IsVersioned() || msg.GetAddressTableLookups().NumLookups() == 0 {
+		return "", nil
+	}
+	info, err := signer.handshake()
+	if err != nil {
+		return "", err
+	}
+	if !info.hasCapability(CAP_LOOKUP_ADDRESSES) {
+		return "", fmt.Errorf("firmware %s does not support %s", info.Version, CAP_LOOKUP_ADDRESSES)
+	}
+	client, err := newRPCClient()
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := withOperationDeadline(context.Background())
+	defer cancel()
+	addresses, err := resolveLookupAddresses(ctx, client, &msg)
+	if err != nil {
+		return "", err
+	}
+	names := make([]string, len(addresses))
+	for i, a := range addresses {
+		names[i] = a.String()
+	}
+	fmt.Fprintf(signer.out, "Sending %d address(es) loaded from %d lookup table(s)\n", len(addresses), msg.GetAddressTableLookups().NumLookups())
+	return "ALT:" + strings.Join(names, ",") + ":", nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// formatDelta renders a signed balance change using formatAmount.
+func formatDelta(before, after uint64) string {
+	if after >= before {
+		return "+" + formatAmount(after-before)
+	}
+	return "-" + formatAmount(before-after)
+}
+
+// runMonitor watches the ESP32 wallet over WebSocket and prints every
+// transaction touching it as it confirms, together with the balance change.
+func runMonitor(args []string) error {
+	fs := flag.NewFlagSet("monitor", flag.ExitOnError)
+	address := fs.String("address", "", "wallet to watch (defaults to the ESP32 public key)")
+	timeout := fs.Duration("timeout", 0, "stop after this long (0 runs until interrupted)")
+	fs.Parse(args)
+
+	var wallet solana.PublicKey
+	if *address != "" {
+		var err error
+		if wallet, err = solana.PublicKeyFromBase58(*address); err != nil {
+			return fmt.Errorf("invalid address %q: %w", *address, err)
+		}
+	} else {
+		esp32, err := openESP32()
+		if err != nil {
+			return err
+		}
+		wallet, err = getESP32PublicKey(esp32)
+		esp32.Close()
+		if err != nil {
+			return fmt.Errorf("error getting ESP32 public key: %w", err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	client, err := newRPCClient()
+	if err != nil {
+		return err
+	}
+	balance, err := client.GetBalance(ctx, wallet, rpc.CommitmentConfirmed)
+	if err != nil {
+		return fmt.Errorf("error fetching balance: %w", err)
+	}
+	lamports := balance.Value
+
+	var lastSig solana.Signature
+	limit := 1
+	recent, err := client.GetSignaturesForAddressWithOpts(ctx, wallet, &rpc.GetSignaturesForAddressOpts{
+		Limit:      &limit,
+		Commitment: rpc.CommitmentConfirmed,
+	})
+	if err != nil {
+		return fmt.Errorf("error fetching signatures: %w", err)
+	}
+	if len(recent) > 0 {
+		lastSig = recent[0].Signature
+	}
+
+	wsClient, err := connectWS(ctx, os.Stdout)
+	if err != nil {
+		return err
+	}
+	defer wsClient.Close()
+
+	sub, err := wsClient.AccountSubscribe(wallet, rpc.CommitmentConfirmed)
+	if err != nil {
+		return fmt.Errorf("error subscribing to %s: %w", wallet, err)
+	}
+	defer sub.Unsubscribe()
+
+	fmt.Printf("Monitoring %s (balance %s)\n", wallet, formatAmount(lamports))
+	for {
+		update, err := sub.Recv(ctx)
+		if err != nil {
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+				fmt.Println("Monitoring stopped")
+				return nil
+			}
+			return fmt.Errorf("error receiving account update: %w", err)
+		}
+
+		newLamports := update.Value.Lamports
+		fmt.Printf("[%s] slot %d: balance %s (%s)\n",
+			time.Now().Format(time.TimeOnly), update.Context.Slot,
+			formatAmount(newLamports), formatDelta(lamports, newLamports))
+		lamports = newLamports
+
+		sigs, err := client.GetSignaturesForAddressWithOpts(ctx, wallet, &rpc.GetSignaturesForAddressOpts{
+			Until:      lastSig,
+			Commitment: rpc.CommitmentConfirmed,
+		})
+		if err != nil {
+			warnf("could not fetch new signatures: %v", err)
+			continue
+		}
+		// Signatures are returned newest first; print them in order.
+		for i := len(sigs) - 1; i >= 0; i-- {
+			status := "ok"
+			if sigs[i].Err != nil {
+				status = fmt.Sprintf("failed: %v", sigs[i].Err)
+			}
+			fmt.Printf("  transaction %s (slot %d, %s)\n", sigs[i].Signature, sigs[i].Slot, status)
+		}
+		if len(sigs) > 0 {
+			lastSig = sigs[0].Signature
+		}
+	}
+}
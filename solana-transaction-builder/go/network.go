@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// network is a cluster preset selected with -network.
+type network struct {
+	rpc string
+	ws  string
+	// genesisHash identifies the cluster; it is empty for localnet, whose
+	// genesis changes every time solana-test-validator is reset.
+	genesisHash string
+	airdrop     bool
+}
+
+var networks = map[string]network{
+	"mainnet":  {RPC_URL, WS_URL, "5eykt4UsFv8P8NJdTREpY1vzqKqZKvdpKuc147dw2N9d", false},
+	"devnet":   {"https://api.devnet.solana.com", "wss://api.devnet.solana.com", "EtWTRABZaYq6iMfeYKouRu166VU2xqa1wcaWoxPkrZBG", true},
+	"testnet":  {"https://api.testnet.solana.com", "wss://api.testnet.solana.com", "4uhcVJyU9pJkvQyS88uRDiswHXSCkY3zQawwpjk2NsNY", true},
+	"localnet": {"http://localhost:8899", "ws://localhost:8900", "", true},
+}
+
+var networkName = flag.String("network", "", "cluster preset: mainnet, devnet, testnet or localnet (default: use -rpc/-ws as given)")
+
+// applyNetwork fills -rpc and -ws from the -network preset unless they were
+// set explicitly on the command line.
+func applyNetwork() error {
+	if *networkName == "" {
+		return nil
+	}
+	preset, ok := networks[*networkName]
+	if !ok {
+		return fmt.Errorf("unknown network %q", *networkName)
+	}
+	explicit := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	if !explicit["rpc"] {
+		*rpcURL = preset.rpc
+	}
+	if !explicit["ws"] {
+		*wsURL = preset.ws
+	}
+	return nil
+}
+
+// newRPCClient connects to the configured RPC endpoint. When a -network
+// preset is selected the node's genesis hash must match it, which catches an
+// -rpc override that points at the wrong cluster.
+func newRPCClient() (*rpc.Client, error) {
+	client := rpc.New(*rpcURL)
+	if preset, ok := networks[*networkName]; ok && preset.genesisHash != "" {
+		ctx, cancel := withOperationDeadline(context.Background())
+		defer cancel()
+		genesis, err := client.GetGenesisHash(ctx)
+		if err != nil {
+			return nil, deadlineError(PHASE_BUILD, fmt.Errorf("error fetching genesis hash from %s: %w", *rpcURL, err))
+		}
+		if genesis.String() != preset.genesisHash {
+			return nil, fmt.Errorf("RPC %s serves genesis %s, which is not %s", *rpcURL, genesis, *networkName)
+		}
+	}
+	return client, nil
+}
+
+// runAirdrop requests test SOL on clusters that support it.
+func runAirdrop(args []string) error {
+	fs := flag.NewFlagSet("airdrop", flag.ExitOnError)
+	lamports := fs.Uint64("amount", solana.LAMPORTS_PER_SOL, "amount to request in lamports")
+	address := fs.String("address", "", "wallet to fund (defaults to the ESP32 public key)")
+	fs.Parse(args)
+
+	if preset, ok := networks[*networkName]; !ok || !preset.airdrop {
+		return fmt.Errorf("airdrops need -network devnet, testnet or localnet")
+	}
+
+	var wallet solana.PublicKey
+	if *address != "" {
+		var err error
+		if wallet, err = solana.PublicKeyFromBase58(*address); err != nil {
+			return fmt.Errorf("invalid address %q: %w", *address, err)
+		}
+	} else {
+		esp32, err := openESP32()
+		if err != nil {
+			return err
+		}
+		wallet, err = getESP32PublicKey(esp32)
+		esp32.Close()
+		if err != nil {
+			return fmt.Errorf("error getting ESP32 public key: %w", err)
+		}
+	}
+
+	ctx, cancel := withOperationDeadline(context.Background())
+	defer cancel()
+	client, err := newRPCClient()
+	if err != nil {
+		return err
+	}
+	sig, err := client.RequestAirdrop(ctx, wallet, *lamports, rpc.CommitmentFinalized)
+	if err != nil {
+		return fmt.Errorf("error requesting airdrop: %w", err)
+	}
+	fmt.Printf("Requested %s for %s: %s\n", formatAmount(*lamports), wallet, sig)
+	if err := pollForConfirmation(ctx, client, sig, *pollInterval); err != nil {
+		return fmt.Errorf("error confirming airdrop %s: %w", sig, err)
+	}
+	fmt.Println("Airdrop confirmed")
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	bin "github.com/gagliardetto/binary"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/programs/system"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// NONCE_STATE_INITIALIZED is the state of a nonce account that holds a
+// usable nonce.
+const NONCE_STATE_INITIALIZED = 1
+
+// durableNonce is a nonce account with the authority allowed to advance it
+// and the nonce it currently stores.
+type durableNonce struct {
+	Account   solana.PublicKey
+	Authority solana.PublicKey
+	Nonce     solana.Hash
+}
+
+// fetchNonce reads the nonce currently stored in account.
+func fetchNonce(client *rpc.Client, account solana.PublicKey) (durableNonce, error) {
+	ctx, cancel := withOperationDeadline(context.Background())
+	defer cancel()
+	info, err := client.GetAccountInfoWithOpts(ctx, account, &rpc.GetAccountInfoOpts{Commitment: rpc.CommitmentFinalized})
+	if err != nil {
+		return durableNonce{}, deadlineError(PHASE_BUILD, fmt.Errorf("error fetching nonce account %s: %w", account, err))
+	}
+	if !info.Value.Owner.Equals(solana.SystemProgramID) {
+		return durableNonce{}, fmt.Errorf("%s is not a nonce account: owned by %s", account, info.Value.Owner)
+	}
+	var state system.NonceAccount
+	if err := state.UnmarshalWithDecoder(bin.NewBinDecoder(info.Value.Data.GetBinary())); err != nil {
+		return durableNonce{}, fmt.Errorf("%s is not a nonce account: %w", account, err)
+	}
+	if state.State != NONCE_STATE_INITIALIZED {
+		return durableNonce{}, fmt.Errorf("nonce account %s is not initialized", account)
+	}
+	return durableNonce{Account: account, Authority: state.AuthorizedPubkey, Nonce: solana.Hash(state.Nonce)}, nil
+}
+
+// createNonceTransaction builds the transfer described by params on a durable
+// nonce instead of a recent blockhash, so it stays valid until the nonce is
+// advanced. The runtime requires the advance to be the first instruction.
+func createNonceTransaction(params transferParams, nonce durableNonce) (*solana.Transaction, error) {
+	instructions := []solana.Instruction{
+		system.NewAdvanceNonceAccountInstruction(nonce.Account, solana.SysVarRecentBlockHashesPubkey, nonce.Authority).Build(),
+	}
+	instructions = append(instructions, transferInstructions(params)...)
+	return solana.NewTransaction(instructions, nonce.Nonce, solana.TransactionPayer(params.FeePayer))
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"unicode/utf8"
+)
+
+// OFFCHAIN_SIGNING_DOMAIN prefixes every off-chain message so its signature
+// can never be mistaken for a transaction signature.
+const OFFCHAIN_SIGNING_DOMAIN = "\xffsolana offchain"
+
+// OFFCHAIN_HEADER_LEN is the size of the version 0 envelope around the
+// message: domain, version, format and a u16 length.
+const OFFCHAIN_HEADER_LEN = len(OFFCHAIN_SIGNING_DOMAIN) + 4
+
+// MAX_OFFCHAIN_LEDGER_LEN and MAX_OFFCHAIN_LEN are the longest messages in the
+// hardware-wallet formats and in extended UTF-8.
+const (
+	MAX_OFFCHAIN_LEDGER_LEN = MAX_TRANSACTION_SIZE - OFFCHAIN_HEADER_LEN
+	MAX_OFFCHAIN_LEN        = 65535 - OFFCHAIN_HEADER_LEN
+)
+
+// Off-chain message formats, from most to least restrictive.
+const (
+	offchainRestrictedASCII byte = 0
+	offchainLimitedUTF8     byte = 1
+	offchainExtendedUTF8    byte = 2
+)
+
+// offchainFormat picks the most restrictive format that can hold message.
+func offchainFormat(message []byte) (byte, error) {
+	if len(message) == 0 {
+		return 0, errors.New("off-chain message is empty")
+	}
+	if !utf8.Valid(message) {
+		return 0, errors.New("off-chain message is not valid UTF-8")
+	}
+	if len(message) > MAX_OFFCHAIN_LEN {
+		return 0, fmt.Errorf("off-chain message is %d bytes, longer than %d", len(message), MAX_OFFCHAIN_LEN)
+	}
+	if len(message) > MAX_OFFCHAIN_LEDGER_LEN {
+		return offchainExtendedUTF8, nil
+	}
+	for _, c := range message {
+		if c < 0x20 || c > 0x7e {
+			return offchainLimitedUTF8, nil
+		}
+	}
+	return offchainRestrictedASCII, nil
+}
+
+// offchainEnvelope wraps message in the version 0 off-chain message header.
+// The result is what gets signed.
+func offchainEnvelope(message []byte) ([]byte, error) {
+	format, err := offchainFormat(message)
+	if err != nil {
+		return nil, err
+	}
+	envelope := append([]byte(OFFCHAIN_SIGNING_DOMAIN), 0, format)
+	envelope = binary.LittleEndian.AppendUint16(envelope, uint16(len(message)))
+	return append(envelope, message...), nil
+}
+
+// runSignOffchain signs a message in the off-chain message format with the
+// ESP32 and checks the signature before printing it.
+func runSignOffchain(args []string) error {
+	fs := flag.NewFlagSet("sign-offchain", flag.ExitOnError)
+	message := fs.String("message", "", "message to sign")
+	in := fs.String("in", "", "read the message from this file instead")
+	fs.Parse(args)
+
+	msg := []byte(*message)
+	if *in != "" {
+		if *message != "" {
+			return fmt.Errorf("give either -message or -in, not both")
+		}
+		data, err := os.ReadFile(*in)
+		if err != nil {
+			return fmt.Errorf("error reading message: %w", err)
+		}
+		msg = data
+	}
+	if *blockhashEcho || *sendLookups {
+		return fmt.Errorf("-blockhash-echo and -send-lookups only apply to transactions")
+	}
+	envelope, err := offchainEnvelope(msg)
+	if err != nil {
+		return err
+	}
+
+	esp32, err := openESP32()
+	if err != nil {
+		return err
+	}
+	defer esp32.Close()
+	esp32Pubkey, err := getESP32PublicKey(esp32)
+	if err != nil {
+		return fmt.Errorf("error getting ESP32 public key: %w", err)
+	}
+	sig, err := signMessageWithESP32(esp32, envelope)
+	if err != nil {
+		return fmt.Errorf("error receiving signature: %w", err)
+	}
+	if !sig.Verify(esp32Pubkey, envelope) {
+		return fmt.Errorf("ESP32 returned a signature that does not verify against %s", esp32Pubkey)
+	}
+	fmt.Println("Signer:", esp32Pubkey)
+	fmt.Println("Signature:", sig)
+	return nil
+}
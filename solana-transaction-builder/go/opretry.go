@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
+	confirm "github.com/gagliardetto/solana-go/rpc/sendAndConfirmTransaction"
+
+	"signer/send"
+)
+
+// OPERATION_RETRY_BACKOFF is the delay before the first operation retry,
+// doubled on each further attempt.
+const OPERATION_RETRY_BACKOFF = 2 * time.Second
+
+// Error codes a node returns when it is rate limiting or cannot serve the
+// request yet. Providers report rate limits as HTTP 429, some of them inside
+// a JSON-RPC error.
+const (
+	RPC_NODE_UNHEALTHY               = -32005
+	RPC_MIN_CONTEXT_SLOT_NOT_REACHED = -32016
+	HTTP_TOO_MANY_REQUESTS           = 429
+)
+
+var maxOperationRetries = flag.Int("max-operation-retries", 0, "rerun the whole send from a fresh build this many times after a recoverable failure (expiry, rate limit, WS drop, node behind)")
+
+// classifyError reports whether err is worth retrying the whole operation
+// for, with a short reason for the log. Anything not known to be recoverable
+// is treated as permanent.
+func classifyError(err error) (recoverable bool, reason string) {
+	var rpcErr *jsonrpc.RPCError
+	var httpErr *jsonrpc.HTTPError
+	switch {
+	case err == nil:
+		return false, ""
+	case errors.Is(err, errDeadline):
+		return false, "deadline exceeded"
+	case errors.Is(err, errRejected):
+		return false, "rejected on the device"
+	case isInsufficientFunds(err):
+		return false, "insufficient funds"
+	case send.IsBlockhashNotFound(err):
+		return true, "blockhash expired"
+	case errors.As(err, &httpErr) && httpErr.Code == HTTP_TOO_MANY_REQUESTS,
+		errors.As(err, &rpcErr) && rpcErr.Code == HTTP_TOO_MANY_REQUESTS:
+		return true, "rate limited"
+	case errors.As(err, &rpcErr) && (rpcErr.Code == RPC_NODE_UNHEALTHY || rpcErr.Code == RPC_MIN_CONTEXT_SLOT_NOT_REACHED):
+		return true, "node behind"
+	case errors.Is(err, errWSUnavailable):
+		return true, "WS connection lost"
+	case errors.Is(err, confirm.ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		return true, "not confirmed in time"
+	}
+	return false, ""
+}
+
+// isInsufficientFunds reports whether preflight or execution failed because
+// an account could not pay.
+func isInsufficientFunds(err error) bool {
+	var rpcErr *jsonrpc.RPCError
+	if errors.As(err, &rpcErr) {
+		if data, ok := rpcErr.Data.(map[string]interface{}); ok {
+			if e, ok := data["err"].(string); ok && e == "InsufficientFundsForFee" {
+				return true
+			}
+			if logs, ok := data["logs"].([]interface{}); ok {
+				for _, line := range logs {
+					if s, ok := line.(string); ok && strings.Contains(s, "insufficient lamports") {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return strings.Contains(err.Error(), "insufficient funds") || strings.Contains(err.Error(), "insufficient lamports")
+}
+
+// safeToRerun checks that a failed attempt can no longer land, so building a
+// new transaction cannot execute the transfer twice. A transaction that was
+// never signed is always safe; otherwise this waits for its blockhash to
+// expire and checks it did not land in the meantime.
+func safeToRerun(client *rpc.Client, result *send.Result) error {
+	if result.Signature.IsZero() {
+		return nil
+	}
+	ctx, cancel := withOperationDeadline(context.Background())
+	defer cancel()
+	for {
+		status, err := signatureStatus(ctx, client, result)
+		if err != nil || status != nil {
+			return err
+		}
+		valid, err := client.IsBlockhashValid(ctx, result.Blockhash, rpc.CommitmentProcessed)
+		if err != nil {
+			return fmt.Errorf("error checking blockhash %s: %w", result.Blockhash, err)
+		}
+		if !valid.Value {
+			// The transaction may have landed between the two calls, more
+			// so when a load balancer sends them to different nodes. Now
+			// that it can no longer land, the history is final.
+			_, err := signatureStatus(ctx, client, result)
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return deadlineError(PHASE_CONFIRM, ctx.Err())
+		case <-time.After(*pollInterval):
+		}
+	}
+}
+
+// signatureStatus looks the attempt's transaction up in the full history. It
+// returns a nil status if the cluster has no record of it, and an error if it
+// landed without failing, since rerunning would then pay twice.
+func signatureStatus(ctx context.Context, client *rpc.Client, result *send.Result) (*rpc.SignatureStatusesResult, error) {
+	statuses, err := client.GetSignatureStatuses(ctx, true, result.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("error checking transaction %s: %w", result.Signature, err)
+	}
+	if len(statuses.Value) == 0 || statuses.Value[0] == nil {
+		return nil, nil
+	}
+	status := statuses.Value[0]
+	if status.Err == nil {
+		return status, fmt.Errorf("transaction %s landed after all (%s)", result.Signature, status.ConfirmationStatus)
+	}
+	return status, nil
+}
+
+// executeSendWithRetries runs executeSend, starting over from a fresh build
+// up to -max-operation-retries times when it fails for a recoverable reason.
+func executeSendWithRetries(client *rpc.Client, opts sendOptions) (*send.Result, error) {
+	backoff := OPERATION_RETRY_BACKOFF
+	for attempt := 0; ; attempt++ {
+		result, err := executeSend(client, opts)
+		if err == nil {
+			return result, nil
+		}
+		recoverable, reason := classifyError(err)
+		if !recoverable || attempt >= *maxOperationRetries {
+			return result, err
+		}
+		if safeErr := safeToRerun(client, result); safeErr != nil {
+			return result, fmt.Errorf("%w (not retrying: %v)", err, safeErr)
+		}
+		wait := capToDeadline(backoff)
+		fmt.Fprintf(opts.output(), "Attempt %d of %d failed (%s): %v; starting over in %s\n", attempt+1, *maxOperationRetries+1, reason, err, wait)
+		if err := checkDeadline(PHASE_BUILD); err != nil {
+			return result, err
+		}
+		time.Sleep(wait)
+		backoff *= 2
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+
+	"signer/send"
+)
+
+// landedLate answers the first signature lookup with no record and every
+// later one with status, as when the transaction lands between the lookup
+// and the blockhash check.
+func landedLate(status interface{}) map[string]func([]json.RawMessage) rpcReply {
+	handlers := chainHandlers()
+	lookups := 0
+	handlers["getSignatureStatuses"] = func([]json.RawMessage) rpcReply {
+		lookups++
+		if lookups == 1 {
+			return withContext([]interface{}{nil})
+		}
+		return withContext([]interface{}{status})
+	}
+	handlers["isBlockhashValid"] = func([]json.RawMessage) rpcReply { return withContext(false) }
+	return handlers
+}
+
+func TestSafeToRerun(t *testing.T) {
+	result := &send.Result{Signature: solana.Signature{1}, Blockhash: solana.Hash{2}}
+	tests := []struct {
+		name    string
+		status  interface{}
+		wantErr bool
+	}{
+		{"never landed", nil, false},
+		{"landed before the blockhash expired", map[string]interface{}{"slot": 101, "err": nil, "confirmationStatus": "confirmed"}, true},
+		{"failed on chain", map[string]interface{}{"slot": 101, "err": map[string]interface{}{"InstructionError": []interface{}{0, "InvalidArgument"}}, "confirmationStatus": "finalized"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := safeToRerun(fakeRPC(t, landedLate(tt.status)), result)
+			if tt.wantErr && (err == nil || !strings.Contains(err.Error(), "landed")) {
+				t.Fatalf("safeToRerun = %v, want a landed error", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("safeToRerun: %v", err)
+			}
+		})
+	}
+}
+
+func TestCapToDeadline(t *testing.T) {
+	defer func(old time.Time) { operationDeadline = old }(operationDeadline)
+
+	operationDeadline = time.Time{}
+	if got := capToDeadline(time.Minute); got != time.Minute {
+		t.Fatalf("capToDeadline without -deadline = %s, want 1m", got)
+	}
+	operationDeadline = time.Now().Add(time.Second)
+	if got := capToDeadline(time.Minute); got > time.Second {
+		t.Fatalf("capToDeadline = %s, want at most the 1s left", got)
+	}
+	operationDeadline = time.Now().Add(-time.Second)
+	if got := capToDeadline(time.Minute); got != 0 {
+		t.Fatalf("capToDeadline past the deadline = %s, want 0", got)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	confirm "github.com/gagliardetto/solana-go/rpc/sendAndConfirmTransaction"
+)
+
+var verbose = flag.Bool("verbose", false, "print extra diagnostics such as the per-phase timing breakdown")
+
+// Names of the phases of an operation, in the order they normally run.
+const (
+	PHASE_PORT_OPEN = "port open"
+	PHASE_HANDSHAKE = "handshake"
+	PHASE_PUBKEY    = "pubkey"
+	PHASE_BUILD     = "build"
+	PHASE_SIGN      = "sign"
+	PHASE_BROADCAST = "broadcast"
+	PHASE_CONFIRM   = "confirm"
+)
+
+// phaseTiming is the time spent in one phase.
+type phaseTiming struct {
+	Phase     string        `json:"phase"`
+	Elapsed   time.Duration `json:"-"`
+	ElapsedMs int64         `json:"elapsedMs"`
+}
+
+// phaseTimer tracks how long each phase of an operation takes. Re-entering
+// a phase adds to its earlier total. A nil *phaseTimer ignores every call, so
+// code shared with untimed commands can record phases unconditionally.
+type phaseTimer struct {
+	phases  []phaseTiming
+	current string
+	started time.Time
+}
+
+// begin ends the current phase and starts name. An empty name only ends the
+// current phase.
+func (t *phaseTimer) begin(name string) {
+	if t == nil {
+		return
+	}
+	t.end()
+	t.current, t.started = name, time.Now()
+}
+
+// phase returns the name of the current phase.
+func (t *phaseTimer) phase() string {
+	if t == nil {
+		return ""
+	}
+	return t.current
+}
+
+// end closes the current phase, if any.
+func (t *phaseTimer) end() {
+	if t == nil || t.current == "" {
+		return
+	}
+	elapsed := time.Since(t.started)
+	name := t.current
+	t.current = ""
+	for i := range t.phases {
+		if t.phases[i].Phase == name {
+			t.phases[i].Elapsed += elapsed
+			t.phases[i].ElapsedMs = t.phases[i].Elapsed.Milliseconds()
+			return
+		}
+	}
+	t.phases = append(t.phases, phaseTiming{Phase: name, Elapsed: elapsed, ElapsedMs: elapsed.Milliseconds()})
+}
+
+// breakdown returns the recorded phases, closing the current one.
+func (t *phaseTimer) breakdown() []phaseTiming {
+	if t == nil {
+		return nil
+	}
+	t.end()
+	return t.phases
+}
+
+// String renders the breakdown as "port open 12ms, pubkey 1.2s, ...".
+func (t *phaseTimer) String() string {
+	var parts []string
+	for _, p := range t.breakdown() {
+		parts = append(parts, fmt.Sprintf("%s %s", p.Phase, p.Elapsed.Round(time.Millisecond)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// fail annotates err with the phase it happened in. Timeouts also carry the
+// full breakdown, which shows where the time budget went.
+func (t *phaseTimer) fail(err error) error {
+	if t == nil || err == nil {
+		return err
+	}
+	phase := t.current
+	if isTimeout(err) {
+		return fmt.Errorf("%s phase timed out: %w (phase timings: %s)", phase, err, t)
+	}
+	return err
+}
+
+// report prints the breakdown to out when -verbose is set.
+func (t *phaseTimer) report(out io.Writer) {
+	if t != nil && *verbose {
+		fmt.Fprintln(out, "Phase timings:", t)
+	}
+}
+
+// isTimeout reports whether err was caused by a timeout anywhere in the
+// stack: the ESP32 watchdog, a context deadline or a confirmation timeout.
+func isTimeout(err error) bool {
+	var netErr interface{ Timeout() bool }
+	return errors.Is(err, errStepTimeout) ||
+		errors.Is(err, errDeadline) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, os.ErrDeadlineExceeded) ||
+		errors.Is(err, confirm.ErrTimeout) ||
+		(errors.As(err, &netErr) && netErr.Timeout())
+}
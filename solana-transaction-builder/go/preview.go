@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// signerRole describes one signature a transaction requires.
+type signerRole struct {
+	Signer   solana.PublicKey `json:"signer"`
+	FeePayer bool             `json:"feePayer"`
+	Writable bool             `json:"writable"`
+	// Device is set when the key is the one held by the ESP32.
+	Device bool `json:"device"`
+	Signed bool `json:"signed"`
+}
+
+// requiredSigners lists the signers of tx in signature order. device may be
+// the zero key when the ESP32 key is not known.
+func requiredSigners(tx *solana.Transaction, device solana.PublicKey) []signerRole {
+	msg := tx.Message
+	var roles []signerRole
+	for i := 0; i < int(msg.Header.NumRequiredSignatures) && i < len(msg.AccountKeys); i++ {
+		key := msg.AccountKeys[i]
+		writable, _ := msg.IsWritable(key)
+		roles = append(roles, signerRole{
+			Signer:   key,
+			FeePayer: i == 0,
+			Writable: writable,
+			Device:   !device.IsZero() && key.Equals(device),
+			Signed:   i < len(tx.Signatures) && !tx.Signatures[i].IsZero(),
+		})
+	}
+	return roles
+}
+
+// printSigners prints the required signers of tx and their roles.
+func printSigners(tx *solana.Transaction, device solana.PublicKey) {
+	fmt.Println("  Required signers:")
+	for _, r := range requiredSigners(tx, device) {
+		line := "    " + r.Signer.String()
+		if r.FeePayer {
+			line += " (fee payer)"
+		}
+		if r.Device {
+			line += " [ESP32]"
+		}
+		if r.Signed {
+			line += " signed"
+		} else {
+			line += " unsigned"
+		}
+		fmt.Println(line)
+	}
+}
+
+// printTransactionPreview explains what tx will do: its fee payer, blockhash,
+// signers, the accounts it touches and a decoded view of every instruction.
+func printTransactionPreview(tx *solana.Transaction, device solana.PublicKey) {
+	msg := tx.Message
+	fmt.Println("Transaction preview:")
+	if len(msg.AccountKeys) > 0 {
+		fmt.Println("  Fee payer:", msg.AccountKeys[0])
+	}
+	fmt.Println("  Blockhash:", msg.RecentBlockhash)
+	fmt.Println("  Required signatures:", msg.Header.NumRequiredSignatures)
+	printSigners(tx, device)
+	fmt.Println("  Accounts:")
+	for _, key := range msg.AccountKeys {
+		role := "readonly"
+		if w, _ := msg.IsWritable(key); w {
+			role = "writable"
+		}
+		if msg.IsSigner(key) {
+			role += ", signer"
+		}
+		fmt.Printf("    %s (%s)\n", key, role)
+	}
+	fmt.Println(tx.String())
+}
+
+// runSigners lists the signers an externally built transaction requires and
+// which of them the connected ESP32 covers.
+func runSigners(args []string) error {
+	fs := flag.NewFlagSet("signers", flag.ExitOnError)
+	in := fs.String("in", "-", "file with the transaction, message or build-tx output (- for stdin)")
+	encoding := fs.String("encoding", "", "encoding of raw input: base64 or base58 (default: whichever parses as a transaction)")
+	useDevice := fs.Bool("device", true, "read the ESP32 public key to mark the signatures it covers")
+	asJSON := fs.Bool("json", false, "print the signers as JSON")
+	fs.Parse(args)
+
+	tx, err := readTransactionInput(*in, *encoding)
+	if err != nil {
+		return err
+	}
+
+	var device solana.PublicKey
+	if *useDevice {
+		esp32, err := openESP32()
+		if err != nil {
+			return err
+		}
+		defer esp32.Close()
+		// Device chatter goes to stderr so -json output stays machine
+		// readable.
+		if *asJSON {
+			esp32.out = os.Stderr
+		}
+		if device, err = getESP32PublicKey(esp32); err != nil {
+			return fmt.Errorf("error getting ESP32 public key: %w", err)
+		}
+	}
+
+	if *asJSON {
+		out, err := json.MarshalIndent(requiredSigners(tx, device), "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+	printSigners(tx, device)
+	return nil
+}
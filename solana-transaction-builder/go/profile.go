@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// PROFILES_FILE holds the saved device profiles and the active one.
+const PROFILES_FILE = "profiles.json"
+
+// deviceProfile is a named set of defaults for one device and cluster. Empty
+// fields leave the corresponding global flag at its default.
+type deviceProfile struct {
+	Port    string `json:"port,omitempty"`
+	Baud    int    `json:"baud,omitempty"`
+	Network string `json:"network,omitempty"`
+	RPC     string `json:"rpc,omitempty"`
+	WS      string `json:"ws,omitempty"`
+	// Pubkey is the public key the device is expected to report.
+	Pubkey string `json:"pubkey,omitempty"`
+}
+
+type profileStore struct {
+	Active   string                   `json:"active,omitempty"`
+	Profiles map[string]deviceProfile `json:"profiles"`
+}
+
+var profileName = flag.String("profile", "", "saved device profile to take defaults from (default: the active profile)")
+
+// expectedPubkey is the device public key required by the selected profile.
+var expectedPubkey solana.PublicKey
+
+func loadProfiles() (profileStore, error) {
+	store := profileStore{Profiles: map[string]deviceProfile{}}
+	if err := loadConfigFile(PROFILES_FILE, &store); err != nil {
+		return store, err
+	}
+	if store.Profiles == nil {
+		store.Profiles = map[string]deviceProfile{}
+	}
+	return store, nil
+}
+
+// applyProfile sets the global flags from the -profile profile, or the active
+// one, unless they were set explicitly on the command line. It runs before
+// applyNetwork, which sees flags set here as explicit, so a profile's own RPC
+// or WS endpoint wins over its network preset.
+func applyProfile() error {
+	store, err := loadProfiles()
+	if err != nil {
+		return err
+	}
+	name := *profileName
+	if name == "" {
+		name = store.Active
+	}
+	if name == "" {
+		return nil
+	}
+	p, ok := store.Profiles[name]
+	if !ok {
+		return fmt.Errorf("unknown profile %q", name)
+	}
+	explicit := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	values := map[string]string{"port": p.Port, "network": p.Network, "rpc": p.RPC, "ws": p.WS}
+	if p.Baud != 0 {
+		values["baud"] = strconv.Itoa(p.Baud)
+	}
+	for flagName, value := range values {
+		if value == "" || explicit[flagName] {
+			continue
+		}
+		if err := flag.Set(flagName, value); err != nil {
+			return fmt.Errorf("profile %s: %w", name, err)
+		}
+	}
+	if p.Pubkey != "" {
+		if expectedPubkey, err = solana.PublicKeyFromBase58(p.Pubkey); err != nil {
+			return fmt.Errorf("profile %s has an invalid pubkey: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// checkExpectedPubkey rejects a device that is not the one the profile names.
+func checkExpectedPubkey(pubkey solana.PublicKey) error {
+	if expectedPubkey.IsZero() || pubkey.Equals(expectedPubkey) {
+		return nil
+	}
+	return fmt.Errorf("device reports %s but the profile expects %s; is the right device connected?", pubkey, expectedPubkey)
+}
+
+// runProfile manages saved device profiles.
+func runProfile(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: profile add|list|use|remove [flags]")
+	}
+	store, err := loadProfiles()
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "add":
+		fs := flag.NewFlagSet("profile add", flag.ExitOnError)
+		name := fs.String("name", "", "profile name")
+		var p deviceProfile
+		fs.StringVar(&p.Port, "port", "", "serial port of the device")
+		fs.IntVar(&p.Baud, "baud", 0, "serial baud rate")
+		fs.StringVar(&p.Network, "network", "", "cluster preset")
+		fs.StringVar(&p.RPC, "rpc", "", "Solana RPC endpoint")
+		fs.StringVar(&p.WS, "ws", "", "Solana WebSocket endpoint")
+		fs.StringVar(&p.Pubkey, "pubkey", "", "public key the device is expected to report")
+		use := fs.Bool("use", false, "make the new profile active")
+		fs.Parse(args[1:])
+		if *name == "" {
+			return fmt.Errorf("-name is required")
+		}
+		if problems := validateProfile(p); len(problems) > 0 {
+			return fmt.Errorf("invalid profile %s: %w", *name, errors.Join(problems...))
+		}
+		store.Profiles[*name] = p
+		if *use {
+			store.Active = *name
+		}
+		fmt.Println("Saved profile", *name)
+	case "list":
+		names := make([]string, 0, len(store.Profiles))
+		for name := range store.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			p := store.Profiles[name]
+			marker := " "
+			if name == store.Active {
+				marker = "*"
+			}
+			fmt.Printf("%s %-12s port=%s baud=%d network=%s rpc=%s ws=%s pubkey=%s\n",
+				marker, name, p.Port, p.Baud, p.Network, p.RPC, p.WS, p.Pubkey)
+		}
+		return nil
+	case "use":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: profile use <name>")
+		}
+		if _, ok := store.Profiles[args[1]]; !ok {
+			return fmt.Errorf("unknown profile %q", args[1])
+		}
+		store.Active = args[1]
+		fmt.Println("Active profile:", args[1])
+	case "remove":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: profile remove <name>")
+		}
+		if _, ok := store.Profiles[args[1]]; !ok {
+			return fmt.Errorf("unknown profile %q", args[1])
+		}
+		delete(store.Profiles, args[1])
+		if store.Active == args[1] {
+			store.Active = ""
+		}
+		fmt.Println("Removed profile", args[1])
+	default:
+		return fmt.Errorf("unknown profile command %q", args[0])
+	}
+	return saveConfigFile(PROFILES_FILE, store)
+}
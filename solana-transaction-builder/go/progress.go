@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PROGRESS_LOG_INTERVAL is how often batch progress is logged when the output
+// is not a terminal.
+const PROGRESS_LOG_INTERVAL = 5 * time.Second
+
+// isTerminal reports whether f is attached to a character device.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// batchProgress tracks a batch of transactions resolving concurrently. On a
+// terminal it keeps a progress bar on the last line of stderr; otherwise it
+// prints a summary line every PROGRESS_LOG_INTERVAL.
+type batchProgress struct {
+	mu        sync.Mutex
+	out       io.Writer
+	tty       bool
+	total     int
+	confirmed int
+	failed    int
+	stop      chan struct{}
+	stopped   sync.WaitGroup
+}
+
+func newBatchProgress(total int) *batchProgress {
+	p := &batchProgress{out: os.Stderr, tty: isTerminal(os.Stderr), total: total, stop: make(chan struct{})}
+	if p.tty {
+		p.draw()
+		return p
+	}
+	p.stopped.Add(1)
+	go func() {
+		defer p.stopped.Done()
+		ticker := time.NewTicker(PROGRESS_LOG_INTERVAL)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+				p.mu.Lock()
+				fmt.Fprintln(p.out, "Progress:", p.counts())
+				p.mu.Unlock()
+			}
+		}
+	}()
+	return p
+}
+
+func (p *batchProgress) counts() string {
+	pending := p.total - p.confirmed - p.failed
+	return fmt.Sprintf("%d confirmed, %d pending, %d failed of %d", p.confirmed, pending, p.failed, p.total)
+}
+
+// draw redraws the bar; p.mu must be held.
+func (p *batchProgress) draw() {
+	const width = 30
+	filled := 0
+	if p.total > 0 {
+		filled = (p.confirmed + p.failed) * width / p.total
+	}
+	bar := strings.Repeat("#", filled) + strings.Repeat("-", width-filled)
+	fmt.Fprintf(p.out, "\r\033[K[%s] %s", bar, p.counts())
+}
+
+// printf prints a line of output without breaking the bar.
+func (p *batchProgress) printf(format string, args ...interface{}) {
+	fmt.Fprintf(p, format, args...)
+}
+
+// Write prints b, which should end in a newline, above the bar, so p can be
+// handed to code that prints its own progress.
+func (p *batchProgress) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.tty {
+		fmt.Fprint(p.out, "\r\033[K")
+	}
+	n, err := p.out.Write(b)
+	if p.tty {
+		p.draw()
+	}
+	return n, err
+}
+
+// resolve records the outcome of one transaction.
+func (p *batchProgress) resolve(ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if ok {
+		p.confirmed++
+	} else {
+		p.failed++
+	}
+	if p.tty {
+		p.draw()
+	}
+}
+
+// finish stops the progress output.
+func (p *batchProgress) finish() {
+	close(p.stop)
+	p.stopped.Wait()
+	if p.tty {
+		fmt.Fprintln(p.out)
+	}
+}
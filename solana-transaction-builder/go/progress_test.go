@@ -0,0 +1,29 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestBatchProgressPrintsAboveBar(t *testing.T) {
+	var out bytes.Buffer
+	p := &batchProgress{out: &out, tty: true, total: 2}
+	p.printf("DONE   %s\n", "a.tx")
+	fee := "Fee: 0.000005 SOL\n"
+	p.Write([]byte(fee))
+
+	got := out.String()
+	for _, line := range []string{"DONE   a.tx\n", fee} {
+		i := strings.Index(got, line)
+		if i < 0 {
+			t.Fatalf("output %q lacks %q", got, line)
+		}
+		if !strings.HasSuffix(got[:i], "\r\033[K") {
+			t.Fatalf("%q is not printed over a cleared line in %q", line, got)
+		}
+		if !strings.HasPrefix(got[i+len(line):], "\r\033[K[") {
+			t.Fatalf("bar is not redrawn after %q in %q", line, got)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// rawAccount is an account of a raw instruction with its explicit flags.
+type rawAccount struct {
+	Pubkey     string `json:"pubkey"`
+	IsSigner   bool   `json:"isSigner"`
+	IsWritable bool   `json:"isWritable"`
+}
+
+// rawInstruction is an arbitrary instruction given as JSON, with the
+// instruction data in base64.
+type rawInstruction struct {
+	ProgramID string       `json:"programId"`
+	Accounts  []rawAccount `json:"accounts"`
+	Data      string       `json:"data"`
+}
+
+// decodeRawInstructions parses a JSON array of raw instructions. The fee payer
+// always signs and is writable, so an account entry for it that says
+// otherwise is rejected rather than silently promoted.
+func decodeRawInstructions(data []byte, feePayer solana.PublicKey) ([]solana.Instruction, error) {
+	var raw []rawInstruction
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("error parsing instructions: %w", err)
+	}
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("no instructions given")
+	}
+	var instructions []solana.Instruction
+	for i, r := range raw {
+		program, err := solana.PublicKeyFromBase58(r.ProgramID)
+		if err != nil {
+			return nil, fmt.Errorf("instruction %d: invalid programId %q: %w", i, r.ProgramID, err)
+		}
+		instData, err := base64.StdEncoding.DecodeString(r.Data)
+		if err != nil {
+			return nil, fmt.Errorf("instruction %d: data is not base64: %w", i, err)
+		}
+		var metas solana.AccountMetaSlice
+		for j, a := range r.Accounts {
+			key, err := solana.PublicKeyFromBase58(a.Pubkey)
+			if err != nil {
+				return nil, fmt.Errorf("instruction %d account %d: invalid pubkey %q: %w", i, j, a.Pubkey, err)
+			}
+			if key.Equals(feePayer) && (!a.IsSigner || !a.IsWritable) {
+				return nil, fmt.Errorf("instruction %d account %d: fee payer %s must be marked isSigner and isWritable", i, j, key)
+			}
+			metas = append(metas, solana.NewAccountMeta(key, a.IsWritable, a.IsSigner))
+		}
+		instructions = append(instructions, solana.NewInstruction(program, metas, instData))
+	}
+	return instructions, nil
+}
+
+// expectedHeader derives the message header instructions must compile to with
+// feePayer paying: an account signs or is writable if any instruction says
+// so, and program IDs not otherwise listed are readonly and unsigned.
+func expectedHeader(feePayer solana.PublicKey, instructions []solana.Instruction) solana.MessageHeader {
+	type flags struct{ signer, writable bool }
+	accounts := map[solana.PublicKey]*flags{feePayer: {signer: true, writable: true}}
+	for _, inst := range instructions {
+		for _, meta := range inst.Accounts() {
+			f, ok := accounts[meta.PublicKey]
+			if !ok {
+				f = &flags{}
+				accounts[meta.PublicKey] = f
+			}
+			f.signer = f.signer || meta.IsSigner
+			f.writable = f.writable || meta.IsWritable
+		}
+		if _, ok := accounts[inst.ProgramID()]; !ok {
+			accounts[inst.ProgramID()] = &flags{}
+		}
+	}
+	var header solana.MessageHeader
+	for _, f := range accounts {
+		switch {
+		case f.signer:
+			header.NumRequiredSignatures++
+			if !f.writable {
+				header.NumReadonlySignedAccounts++
+			}
+		case !f.writable:
+			header.NumReadonlyUnsignedAccounts++
+		}
+	}
+	return header
+}
+
+// checkCompiledFlags verifies that the compiled message of tx encodes the
+// signer and writable flags the instructions asked for.
+func checkCompiledFlags(tx *solana.Transaction, feePayer solana.PublicKey, instructions []solana.Instruction) error {
+	msg := tx.Message
+	if want := expectedHeader(feePayer, instructions); msg.Header != want {
+		return fmt.Errorf("compiled header %+v does not match expected %+v", msg.Header, want)
+	}
+	if len(msg.AccountKeys) == 0 || !msg.AccountKeys[0].Equals(feePayer) {
+		return fmt.Errorf("fee payer %s is not the first account", feePayer)
+	}
+	for _, inst := range instructions {
+		for _, meta := range inst.Accounts() {
+			writable, err := msg.IsWritable(meta.PublicKey)
+			if err != nil {
+				return err
+			}
+			if meta.IsSigner && !msg.IsSigner(meta.PublicKey) {
+				return fmt.Errorf("account %s should sign but was compiled as non-signer", meta.PublicKey)
+			}
+			if meta.IsWritable && !writable {
+				return fmt.Errorf("account %s should be writable but was compiled as readonly", meta.PublicKey)
+			}
+		}
+	}
+	return nil
+}
+
+// buildRawTransaction builds a transaction from the JSON raw instructions in
+// file, paid for by feePayer, and checks it compiled to the flags they ask for.
+func buildRawTransaction(client *rpc.Client, file string, feePayer solana.PublicKey) (*solana.Transaction, blockhashInfo, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, blockhashInfo{}, fmt.Errorf("error reading instructions: %w", err)
+	}
+	instructions, err := decodeRawInstructions(data, feePayer)
+	if err != nil {
+		return nil, blockhashInfo{}, err
+	}
+	tx, blockhash, err := buildTransaction(os.Stdout, client, instructions, feePayer)
+	if err != nil {
+		return nil, blockhashInfo{}, err
+	}
+	if err := checkCompiledFlags(tx, feePayer, instructions); err != nil {
+		return nil, blockhashInfo{}, fmt.Errorf("refusing the compiled transaction: %w", err)
+	}
+	return tx, blockhash, nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// rawJSON encodes instructions as the -instructions file does.
+func rawJSON(t *testing.T, instructions []rawInstruction) []byte {
+	t.Helper()
+	data, err := json.Marshal(instructions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// compile builds an unsigned transaction from instructions paid for by
+// feePayer, as build-tx does.
+func compile(t *testing.T, instructions []solana.Instruction, feePayer solana.PublicKey) *solana.Transaction {
+	t.Helper()
+	tx, err := solana.NewTransaction(instructions, solana.Hash{1}, solana.TransactionPayer(feePayer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+func TestRawInstructionsHeaderCounts(t *testing.T) {
+	feePayer := solana.NewWallet().PublicKey()
+	readonlySigner := solana.NewWallet().PublicKey()
+	writableSigner := solana.NewWallet().PublicKey()
+	writable := solana.NewWallet().PublicKey()
+	readonly := solana.NewWallet().PublicKey()
+	program := solana.NewWallet().PublicKey()
+
+	tests := []struct {
+		name     string
+		accounts []rawAccount
+		want     solana.MessageHeader
+	}{
+		{
+			name:     "fee payer only",
+			accounts: []rawAccount{{feePayer.String(), true, true}},
+			want:     solana.MessageHeader{NumRequiredSignatures: 1, NumReadonlyUnsignedAccounts: 1},
+		},
+		{
+			name: "every combination",
+			accounts: []rawAccount{
+				{feePayer.String(), true, true},
+				{readonlySigner.String(), true, false},
+				{writableSigner.String(), true, true},
+				{writable.String(), false, true},
+				{readonly.String(), false, false},
+			},
+			want: solana.MessageHeader{NumRequiredSignatures: 3, NumReadonlySignedAccounts: 1, NumReadonlyUnsignedAccounts: 2},
+		},
+		{
+			name: "writable and signer flags are merged",
+			accounts: []rawAccount{
+				{readonly.String(), false, false},
+				{readonly.String(), false, true},
+				{readonlySigner.String(), false, false},
+				{readonlySigner.String(), true, false},
+			},
+			want: solana.MessageHeader{NumRequiredSignatures: 2, NumReadonlySignedAccounts: 1, NumReadonlyUnsignedAccounts: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := rawJSON(t, []rawInstruction{{ProgramID: program.String(), Accounts: tt.accounts, Data: "AQID"}})
+			instructions, err := decodeRawInstructions(data, feePayer)
+			if err != nil {
+				t.Fatalf("decodeRawInstructions: %v", err)
+			}
+			if got := expectedHeader(feePayer, instructions); got != tt.want {
+				t.Fatalf("expectedHeader = %+v, want %+v", got, tt.want)
+			}
+			tx := compile(t, instructions, feePayer)
+			if tx.Message.Header != tt.want {
+				t.Fatalf("compiled header = %+v, want %+v", tx.Message.Header, tt.want)
+			}
+			if err := checkCompiledFlags(tx, feePayer, instructions); err != nil {
+				t.Fatalf("checkCompiledFlags: %v", err)
+			}
+		})
+	}
+}
+
+func TestRawInstructionsRejectFeePayerFlags(t *testing.T) {
+	feePayer := solana.NewWallet().PublicKey()
+	program := solana.NewWallet().PublicKey()
+	for _, account := range []rawAccount{
+		{feePayer.String(), false, true},
+		{feePayer.String(), true, false},
+		{feePayer.String(), false, false},
+	} {
+		data := rawJSON(t, []rawInstruction{{ProgramID: program.String(), Accounts: []rawAccount{account}}})
+		_, err := decodeRawInstructions(data, feePayer)
+		if err == nil || !strings.Contains(err.Error(), "fee payer") {
+			t.Fatalf("decodeRawInstructions(isSigner=%t, isWritable=%t) error = %v, want a fee payer error", account.IsSigner, account.IsWritable, err)
+		}
+	}
+}
+
+func TestCheckCompiledFlagsDetectsMismatch(t *testing.T) {
+	feePayer := solana.NewWallet().PublicKey()
+	writable := solana.NewWallet().PublicKey()
+	program := solana.NewWallet().PublicKey()
+	data := rawJSON(t, []rawInstruction{{ProgramID: program.String(), Accounts: []rawAccount{{writable.String(), false, true}}}})
+	instructions, err := decodeRawInstructions(data, feePayer)
+	if err != nil {
+		t.Fatalf("decodeRawInstructions: %v", err)
+	}
+
+	tx := compile(t, instructions, feePayer)
+	tx.Message.Header.NumReadonlyUnsignedAccounts++
+	if err := checkCompiledFlags(tx, feePayer, instructions); err == nil {
+		t.Fatal("checkCompiledFlags accepted a header that makes a writable account readonly")
+	}
+
+	other := solana.NewWallet().PublicKey()
+	tx = compile(t, instructions, other)
+	if err := checkCompiledFlags(tx, feePayer, instructions); err == nil {
+		t.Fatal("checkCompiledFlags accepted a transaction paid for by another account")
+	}
+}
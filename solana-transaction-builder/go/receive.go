@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/gagliardetto/solana-go"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// QR_PNG_SIZE is the width and height in pixels of a QR code written with -png.
+const QR_PNG_SIZE = 512
+
+// paymentURI builds a Solana Pay transfer request URI for recipient. A zero
+// amount leaves the amount to the payer.
+func paymentURI(recipient solana.PublicKey, lamports uint64, label, message string) string {
+	query := url.Values{}
+	if lamports > 0 {
+		query.Set("amount", strings.TrimSuffix(formatSOL(lamports), " SOL"))
+	}
+	if label != "" {
+		query.Set("label", label)
+	}
+	if message != "" {
+		query.Set("message", message)
+	}
+	uri := "solana:" + recipient.String()
+	if len(query) > 0 {
+		uri += "?" + query.Encode()
+	}
+	return uri
+}
+
+// runReceive shows the ESP32 wallet address as text and a terminal QR code.
+func runReceive(args []string) error {
+	fs := flag.NewFlagSet("receive", flag.ExitOnError)
+	uri := fs.Bool("uri", false, "encode a solana: payment request URI instead of the bare address")
+	amount := fs.Uint64("amount", 0, "requested amount in lamports (implies -uri)")
+	label := fs.String("label", "", "payment request label (implies -uri)")
+	message := fs.String("message", "", "payment request message (implies -uri)")
+	png := fs.String("png", "", "also write the QR code to this PNG file")
+	fs.Parse(args)
+
+	esp32, err := openESP32()
+	if err != nil {
+		return err
+	}
+	defer esp32.Close()
+	esp32Pubkey, err := getESP32PublicKey(esp32)
+	if err != nil {
+		return fmt.Errorf("error getting ESP32 public key: %w", err)
+	}
+
+	content := esp32Pubkey.String()
+	if *uri || *amount > 0 || *label != "" || *message != "" {
+		content = paymentURI(esp32Pubkey, *amount, *label, *message)
+	}
+	code, err := qrcode.New(content, qrcode.Medium)
+	if err != nil {
+		return fmt.Errorf("error encoding QR code: %w", err)
+	}
+	fmt.Print(code.ToSmallString(false))
+	fmt.Println(content)
+	if *png != "" {
+		if err := code.WriteFile(QR_PNG_SIZE, *png); err != nil {
+			return fmt.Errorf("error writing %s: %w", *png, err)
+		}
+		fmt.Println("Wrote QR code to", *png)
+	}
+	return nil
+}
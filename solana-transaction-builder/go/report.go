@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gagliardetto/solana-go"
+	computebudget "github.com/gagliardetto/solana-go/programs/compute-budget"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// reportFormat selects the post-confirmation report printed by -tx-report.
+type reportFormat string
+
+const (
+	reportNone reportFormat = ""
+	reportText reportFormat = "text"
+	reportJSON reportFormat = "json"
+)
+
+func (f *reportFormat) String() string { return string(*f) }
+
+func (f *reportFormat) Set(s string) error {
+	switch v := reportFormat(strings.ToLower(s)); v {
+	case reportNone, reportText, reportJSON:
+		*f = v
+		return nil
+	}
+	return fmt.Errorf("unknown report format %q (want text or json)", s)
+}
+
+var txReport = reportNone
+
+func init() {
+	flag.Var(&txReport, "tx-report", "after confirmation fetch the full transaction record and print it as text or json")
+}
+
+// DEFAULT_CU_PER_INSTRUCTION and MAX_COMPUTE_UNITS give the compute unit limit
+// of a transaction that does not set one.
+const (
+	DEFAULT_CU_PER_INSTRUCTION = 200_000
+	MAX_COMPUTE_UNITS          = 1_400_000
+)
+
+// CU_WARN_RATIO is the share of the compute unit limit above which a
+// transaction is reported as close to running out.
+const CU_WARN_RATIO = 0.9
+
+// computeUnitLimit returns the compute unit limit of tx and whether it was set
+// explicitly with a SetComputeUnitLimit instruction.
+func computeUnitLimit(tx *solana.Transaction) (uint32, bool) {
+	msg := tx.Message
+	var other uint32
+	for _, inst := range msg.Instructions {
+		program, err := msg.Program(inst.ProgramIDIndex)
+		if err != nil {
+			continue
+		}
+		if !program.Equals(computebudget.ProgramID) {
+			other++
+			continue
+		}
+		if len(inst.Data) >= 5 && inst.Data[0] == computebudget.Instruction_SetComputeUnitLimit {
+			return binary.LittleEndian.Uint32(inst.Data[1:5]), true
+		}
+	}
+	limit := other * DEFAULT_CU_PER_INSTRUCTION
+	if limit > MAX_COMPUTE_UNITS {
+		limit = MAX_COMPUTE_UNITS
+	}
+	return limit, false
+}
+
+// balanceChange is the SOL balance of one account before and after a
+// transaction.
+type balanceChange struct {
+	Account solana.PublicKey `json:"account"`
+	Pre     uint64           `json:"pre"`
+	Post    uint64           `json:"post"`
+	Delta   int64            `json:"delta"`
+}
+
+// transactionReport is the on-chain record of a confirmed transaction.
+type transactionReport struct {
+	Signature      solana.Signature `json:"signature"`
+	Slot           uint64           `json:"slot"`
+	BlockTime      *int64           `json:"blockTime,omitempty"`
+	Fee            uint64           `json:"fee"`
+	ComputeUnits   *uint64          `json:"computeUnitsConsumed,omitempty"`
+	ComputeLimit   uint32           `json:"computeUnitLimit"`
+	Err            interface{}      `json:"err,omitempty"`
+	BalanceChanges []balanceChange  `json:"balanceChanges"`
+	Logs           []string         `json:"logMessages"`
+}
+
+// fetchTransactionReport loads the record of sig. Balances are matched to the
+// static account keys of tx, followed by any addresses loaded from lookup
+// tables.
+func fetchTransactionReport(ctx context.Context, client *rpc.Client, tx *solana.Transaction, sig solana.Signature) (*transactionReport, error) {
+	maxVersion := uint64(0)
+	result, err := client.GetTransaction(ctx, sig, &rpc.GetTransactionOpts{
+		Encoding:                       solana.EncodingBase64,
+		Commitment:                     rpc.CommitmentConfirmed,
+		MaxSupportedTransactionVersion: &maxVersion,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching transaction %s: %w", sig, err)
+	}
+	if result.Meta == nil {
+		return nil, fmt.Errorf("transaction %s has no metadata", sig)
+	}
+	meta := result.Meta
+	report := &transactionReport{
+		Signature:    sig,
+		Slot:         result.Slot,
+		Fee:          meta.Fee,
+		ComputeUnits: meta.ComputeUnitsConsumed,
+		Err:          meta.Err,
+		Logs:         meta.LogMessages,
+	}
+	report.ComputeLimit, _ = computeUnitLimit(tx)
+	if result.BlockTime != nil {
+		t := int64(*result.BlockTime)
+		report.BlockTime = &t
+	}
+	keys := append(solana.PublicKeySlice{}, tx.Message.AccountKeys...)
+	keys = append(keys, meta.LoadedAddresses.Writable...)
+	keys = append(keys, meta.LoadedAddresses.ReadOnly...)
+	for i, key := range keys {
+		if i >= len(meta.PreBalances) || i >= len(meta.PostBalances) {
+			break
+		}
+		pre, post := meta.PreBalances[i], meta.PostBalances[i]
+		report.BalanceChanges = append(report.BalanceChanges, balanceChange{
+			Account: key,
+			Pre:     pre,
+			Post:    post,
+			Delta:   int64(post) - int64(pre),
+		})
+	}
+	return report, nil
+}
+
+// computeUsage describes the compute units consumed against the limit.
+func computeUsage(report *transactionReport, tx *solana.Transaction) string {
+	source := "default"
+	if _, explicit := computeUnitLimit(tx); explicit {
+		source = "set"
+	}
+	return fmt.Sprintf("%d of %d (%s limit)", *report.ComputeUnits, report.ComputeLimit, source)
+}
+
+// warnComputeUsage warns when the transaction came close to its compute unit
+// limit.
+func warnComputeUsage(out io.Writer, report *transactionReport) {
+	if report.ComputeUnits == nil || report.ComputeLimit == 0 {
+		return
+	}
+	ratio := float64(*report.ComputeUnits) / float64(report.ComputeLimit)
+	if ratio >= CU_WARN_RATIO {
+		warnTo(out, "the transaction used %.0f%% of its compute unit limit; consider raising -compute-unit-limit", 100*ratio)
+	}
+}
+
+// printTransactionReport fetches the record of sig and prints the fee and
+// compute usage, or the full record if -tx-report is set. The transaction has
+// already landed, so failures only warn and return nil.
+func printTransactionReport(ctx context.Context, out io.Writer, client *rpc.Client, tx *solana.Transaction, sig solana.Signature) *transactionReport {
+	report, err := fetchTransactionReport(ctx, client, tx, sig)
+	if err != nil {
+		warnTo(out, "no transaction report: %v", err)
+		return nil
+	}
+	if txReport == reportNone {
+		if report.ComputeUnits != nil {
+			fmt.Fprintf(out, "Fee: %s, compute units consumed: %s\n", formatAmount(report.Fee), computeUsage(report, tx))
+		}
+		warnComputeUsage(out, report)
+		return report
+	}
+	if txReport == reportJSON {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			warnTo(out, "no transaction report: %v", err)
+			return report
+		}
+		fmt.Fprintln(out, string(data))
+		return report
+	}
+
+	fmt.Fprintln(out, "Transaction report for", report.Signature)
+	fmt.Fprintln(out, "  Slot:", report.Slot)
+	if report.BlockTime != nil {
+		fmt.Fprintln(out, "  Block time:", solana.UnixTimeSeconds(*report.BlockTime).Time().UTC())
+	}
+	fmt.Fprintln(out, "  Fee:", formatAmount(report.Fee))
+	if report.ComputeUnits != nil {
+		fmt.Fprintln(out, "  Compute units consumed:", computeUsage(report, tx))
+	}
+	if report.Err != nil {
+		fmt.Fprintln(out, "  Error:", report.Err)
+	}
+	fmt.Fprintln(out, "  Balance changes:")
+	for _, c := range report.BalanceChanges {
+		if c.Delta == 0 {
+			continue
+		}
+		fmt.Fprintf(out, "    %s %s\n", c.Account, formatDelta(c.Pre, c.Post))
+	}
+	fmt.Fprintln(out, "  Logs:")
+	for _, line := range report.Logs {
+		fmt.Fprintln(out, "    "+line)
+	}
+	warnComputeUsage(out, report)
+	return report
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// warnings records every warning printed with warnf so results can carry
+// them.
+var warnings struct {
+	sync.Mutex
+	log []string
+}
+
+// warnf prints a warning and records it.
+func warnf(format string, args ...interface{}) {
+	warnTo(os.Stdout, format, args...)
+}
+
+// warnTo is warnf printing to out.
+func warnTo(out io.Writer, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	warnings.Lock()
+	warnings.log = append(warnings.log, msg)
+	warnings.Unlock()
+	fmt.Fprintln(out, "Warning:", msg)
+}
+
+// warningCount returns how many warnings have been recorded so far.
+func warningCount() int {
+	warnings.Lock()
+	defer warnings.Unlock()
+	return len(warnings.log)
+}
+
+// warningsSince returns the warnings recorded after the first n.
+func warningsSince(n int) []string {
+	warnings.Lock()
+	defer warnings.Unlock()
+	if n >= len(warnings.log) {
+		return nil
+	}
+	return append([]string{}, warnings.log[n:]...)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// runRetry replays a transaction that did not land: its message is kept
+// byte for byte except for the blockhash, re-signed by the ESP32 and
+// broadcast. Replaying a transaction that may still land would execute it
+// twice, so the original must have landed as failed or have expired.
+func runRetry(args []string) error {
+	fs := flag.NewFlagSet("retry", flag.ExitOnError)
+	in := fs.String("in", "-", "file with the transaction, build-tx output or bundle to replay (- for stdin)")
+	encoding := fs.String("encoding", "", "encoding of raw input: base64 or base58 (default: whichever parses as a transaction)")
+	fs.Parse(args)
+
+	tx, err := readTransactionInput(*in, *encoding)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := withOperationDeadline(context.Background())
+	defer cancel()
+	client, err := newRPCClient()
+	if err != nil {
+		return err
+	}
+	if len(tx.Signatures) > 0 && !tx.Signatures[0].IsZero() {
+		statuses, err := client.GetSignatureStatuses(ctx, true, tx.Signatures[0])
+		if err != nil {
+			return fmt.Errorf("error checking original transaction: %w", err)
+		}
+		if len(statuses.Value) > 0 && statuses.Value[0] != nil && statuses.Value[0].Err == nil {
+			return fmt.Errorf("original transaction %s already landed; not replaying it", tx.Signatures[0])
+		}
+	}
+	valid, err := client.IsBlockhashValid(ctx, tx.Message.RecentBlockhash, rpc.CommitmentProcessed)
+	if err != nil {
+		return fmt.Errorf("error checking original blockhash: %w", err)
+	}
+	if valid.Value {
+		return fmt.Errorf("blockhash %s is still valid, so the original may still land; wait for it to expire", tx.Message.RecentBlockhash)
+	}
+
+	esp32, err := openESP32()
+	if err != nil {
+		return err
+	}
+	defer esp32.Close()
+	esp32Pubkey, err := getESP32PublicKey(esp32)
+	if err != nil {
+		return fmt.Errorf("error getting ESP32 public key: %w", err)
+	}
+	signers := tx.Message.Signers()
+	if len(signers) != 1 || !signers[0].Equals(esp32Pubkey) {
+		return fmt.Errorf("retry only replays transactions signed by the device alone; use the bundle commands for %d signers", len(signers))
+	}
+
+	blockhash, info, err := latestBlockhash(os.Stdout, client)
+	if err != nil {
+		return fmt.Errorf("error fetching blockhash: %w", err)
+	}
+	fmt.Printf("Replacing blockhash %s with %s\n", tx.Message.RecentBlockhash, blockhash)
+	tx.Message.RecentBlockhash = blockhash
+	tx.Signatures = nil
+	if err := signWithESP32(esp32, esp32Pubkey, tx); err != nil {
+		return err
+	}
+	sig, err := broadcastTransaction(client, tx, info.Slot, nil)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Transaction submitted with signature:", sig)
+	return nil
+}
@@ -0,0 +1,196 @@
+// Package send is the send flow of the signer: build a transaction, have a
+// hardware wallet sign it and broadcast it, refreshing the blockhash and
+// signing again when it goes stale. The device and the cluster are reached
+// through a Flow, so programs other than the CLI can embed the flow.
+package send
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
+)
+
+// Statuses a Result reports.
+const (
+	StatusConfirmed = "confirmed"
+	StatusFailed    = "failed"
+)
+
+// ErrBlockhashNotFound is wrapped by Flow.Simulate errors caused by the node
+// not knowing the transaction's blockhash.
+var ErrBlockhashNotFound = errors.New("blockhash not found")
+
+// Payment is a single SOL transfer to one recipient.
+type Payment struct {
+	Recipient solana.PublicKey
+	Lamports  uint64
+}
+
+// Result is the outcome of a send. Fields are only ever added, never renamed
+// or removed.
+type Result struct {
+	// Signature is the transaction signature. It is zero if the send failed
+	// before the device signed.
+	Signature solana.Signature `json:"signature"`
+	// Blockhash is the blockhash the signed transaction uses.
+	Blockhash solana.Hash `json:"blockhash"`
+	// Status is StatusConfirmed once the transaction is finalized, otherwise
+	// StatusFailed.
+	Status string `json:"status"`
+	// Slot is the slot the transaction landed in, or 0 if it is unknown.
+	Slot uint64 `json:"slot,omitempty"`
+	// Fee is the fee charged in lamports, or 0 if it is unknown.
+	Fee uint64 `json:"fee,omitempty"`
+	// Payments are the transfers the transaction makes.
+	Payments []Payment `json:"payments,omitempty"`
+	// Warnings are the warnings printed while the send ran. Send leaves
+	// them to the caller, which owns the output.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Confirmation is what is known about a confirmed transaction. Zero fields
+// are unknown.
+type Confirmation struct {
+	Slot uint64
+	Fee  uint64
+}
+
+// Flow is the device and cluster side of a send.
+type Flow interface {
+	// Build returns a new unsigned transaction on a fresh blockhash.
+	Build() (*solana.Transaction, error)
+	// Simulate runs the preflight simulation on the unsigned tx.
+	Simulate(tx *solana.Transaction) error
+	// Sign has the device sign tx, placing the signature in tx.
+	Sign(tx *solana.Transaction) error
+	// Broadcast submits the signed tx and waits until it is confirmed.
+	Broadcast(tx *solana.Transaction) (Confirmation, error)
+}
+
+// Options configures Send.
+type Options struct {
+	// Payments are the transfers the transaction makes, copied into the
+	// Result.
+	Payments []Payment
+	// MaxTxAge, if positive, has a transaction built longer ago than this
+	// rebuilt and signed again before it is broadcast.
+	MaxTxAge time.Duration
+	// MaxResigns bounds how often a stale transaction is rebuilt.
+	MaxResigns int
+	// BeforeSign, if set, runs on the first transaction before the device
+	// is asked to sign it. An error aborts the send.
+	BeforeSign func(tx *solana.Transaction) error
+	// Out receives progress messages; nil discards them.
+	Out io.Writer
+}
+
+// IsBlockhashNotFound reports whether err is a simulation failure caused by
+// the node not knowing the transaction's blockhash. Unlike program errors
+// this is cured by signing again with a fresh blockhash.
+func IsBlockhashNotFound(err error) bool {
+	if errors.Is(err, ErrBlockhashNotFound) {
+		return true
+	}
+	var rpcErr *jsonrpc.RPCError
+	if !errors.As(err, &rpcErr) {
+		return false
+	}
+	if data, ok := rpcErr.Data.(map[string]interface{}); ok {
+		if e, ok := data["err"].(string); ok {
+			return e == "BlockhashNotFound"
+		}
+	}
+	return strings.Contains(rpcErr.Message, "Blockhash not found")
+}
+
+// Send builds a transaction with flow, simulates it, has the device sign it
+// and broadcasts it. A blockhash the node does not know is refreshed, before
+// signing when simulation reports it and by signing again when preflight
+// does. The result is returned even on failure, with as much filled in as
+// the send got to.
+func Send(flow Flow, opts Options) (*Result, error) {
+	result := &Result{Status: StatusFailed, Payments: opts.Payments}
+	out := opts.Out
+	if out == nil {
+		out = io.Discard
+	}
+
+	tx, err := flow.Build()
+	if err != nil {
+		return result, err
+	}
+	for refreshes := 0; ; refreshes++ {
+		err := flow.Simulate(tx)
+		if err == nil {
+			break
+		}
+		if !IsBlockhashNotFound(err) || refreshes == opts.MaxResigns {
+			return result, err
+		}
+		fmt.Fprintln(out, "Simulation did not find the blockhash; refreshing it before signing")
+		if tx, err = flow.Build(); err != nil {
+			return result, err
+		}
+	}
+	builtAt := time.Now()
+	if opts.BeforeSign != nil {
+		if err := opts.BeforeSign(tx); err != nil {
+			return result, err
+		}
+	}
+
+	sign := func() error {
+		if err := flow.Sign(tx); err != nil {
+			return err
+		}
+		result.Signature, result.Blockhash = tx.Signatures[0], tx.Message.RecentBlockhash
+		return nil
+	}
+	// rebuild refreshes the blockhash and has the device sign again.
+	rebuild := func() error {
+		var err error
+		if tx, err = flow.Build(); err != nil {
+			return err
+		}
+		builtAt = time.Now()
+		return sign()
+	}
+	if err := sign(); err != nil {
+		return result, err
+	}
+
+	var confirmation Confirmation
+	for resigns := 0; ; resigns++ {
+		if opts.MaxTxAge > 0 && time.Since(builtAt) > opts.MaxTxAge {
+			if resigns == opts.MaxResigns {
+				return result, fmt.Errorf("transaction still older than the maximum age %s after %d rebuilds", opts.MaxTxAge, opts.MaxResigns)
+			}
+			fmt.Fprintf(out, "Transaction is %s old, over the maximum age %s; rebuilding and re-signing\n", time.Since(builtAt).Round(time.Millisecond), opts.MaxTxAge)
+			if err := rebuild(); err != nil {
+				return result, err
+			}
+			continue
+		}
+		confirmation, err = flow.Broadcast(tx)
+		if IsBlockhashNotFound(err) && resigns < opts.MaxResigns {
+			fmt.Fprintln(out, "Preflight did not find the blockhash; refreshing it and re-signing")
+			if err := rebuild(); err != nil {
+				return result, err
+			}
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+		break
+	}
+	result.Status = StatusConfirmed
+	result.Slot = confirmation.Slot
+	result.Fee = confirmation.Fee
+	return result, nil
+}
@@ -0,0 +1,148 @@
+package send
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// fakeFlow builds transactions on numbered blockhashes and fails the steps
+// it is scripted to fail. Each script entry is the error for one call.
+type fakeFlow struct {
+	builds     int
+	signs      int
+	broadcasts int
+	simulate   []error
+	broadcast  []error
+	signDelay  time.Duration
+}
+
+func (f *fakeFlow) Build() (*solana.Transaction, error) {
+	f.builds++
+	payer := solana.PublicKey{1}
+	return &solana.Transaction{Message: solana.Message{
+		AccountKeys:     solana.PublicKeySlice{payer},
+		Header:          solana.MessageHeader{NumRequiredSignatures: 1},
+		RecentBlockhash: solana.Hash{byte(f.builds)},
+	}}, nil
+}
+
+func (f *fakeFlow) Simulate(*solana.Transaction) error {
+	return next(&f.simulate)
+}
+
+func (f *fakeFlow) Sign(tx *solana.Transaction) error {
+	f.signs++
+	time.Sleep(f.signDelay)
+	tx.Signatures = []solana.Signature{{byte(f.signs)}}
+	return nil
+}
+
+func (f *fakeFlow) Broadcast(*solana.Transaction) (Confirmation, error) {
+	f.broadcasts++
+	if err := next(&f.broadcast); err != nil {
+		return Confirmation{}, err
+	}
+	return Confirmation{Slot: 42, Fee: 5000}, nil
+}
+
+// next pops the first scripted error, or returns nil once the script is done.
+func next(script *[]error) error {
+	if len(*script) == 0 {
+		return nil
+	}
+	err := (*script)[0]
+	*script = (*script)[1:]
+	return err
+}
+
+var stale = fmt.Errorf("simulation failed: %w", ErrBlockhashNotFound)
+
+func TestSendConfirms(t *testing.T) {
+	flow := &fakeFlow{}
+	payments := []Payment{{Recipient: solana.PublicKey{2}, Lamports: 1000}}
+	result, err := Send(flow, Options{Payments: payments, MaxResigns: 3})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if result.Status != StatusConfirmed || result.Slot != 42 || result.Fee != 5000 {
+		t.Fatalf("result = %+v", result)
+	}
+	if result.Signature != (solana.Signature{1}) || result.Blockhash != (solana.Hash{1}) {
+		t.Fatalf("result signature %s on blockhash %s, want the first", result.Signature, result.Blockhash)
+	}
+	if len(result.Payments) != 1 {
+		t.Fatalf("result carries %d payments, want 1", len(result.Payments))
+	}
+}
+
+func TestSendSimulationErrorAbortsBeforeSigning(t *testing.T) {
+	flow := &fakeFlow{simulate: []error{errors.New("custom program error: 0x1")}}
+	result, err := Send(flow, Options{MaxResigns: 3})
+	if err == nil {
+		t.Fatal("Send succeeded, want the simulation error")
+	}
+	if flow.signs != 0 || flow.broadcasts != 0 {
+		t.Fatalf("signed %d and broadcast %d time(s) after a failed simulation", flow.signs, flow.broadcasts)
+	}
+	if result.Status != StatusFailed || !result.Signature.IsZero() {
+		t.Fatalf("result = %+v, want a failed unsigned result", result)
+	}
+}
+
+func TestSendRefreshesStaleBlockhashBeforeSigning(t *testing.T) {
+	flow := &fakeFlow{simulate: []error{stale, stale}}
+	if _, err := Send(flow, Options{MaxResigns: 3}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if flow.builds != 3 || flow.signs != 1 {
+		t.Fatalf("built %d and signed %d time(s), want 3 and 1", flow.builds, flow.signs)
+	}
+}
+
+func TestSendResignsOnPreflightBlockhashNotFound(t *testing.T) {
+	flow := &fakeFlow{broadcast: []error{stale}}
+	result, err := Send(flow, Options{MaxResigns: 3})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if flow.signs != 2 || flow.broadcasts != 2 {
+		t.Fatalf("signed %d and broadcast %d time(s), want 2 each", flow.signs, flow.broadcasts)
+	}
+	if result.Blockhash != (solana.Hash{2}) {
+		t.Fatalf("result blockhash %s, want the rebuilt one", result.Blockhash)
+	}
+}
+
+func TestSendGivesUpAfterMaxResigns(t *testing.T) {
+	flow := &fakeFlow{broadcast: []error{stale, stale, stale}}
+	if _, err := Send(flow, Options{MaxResigns: 2}); !IsBlockhashNotFound(err) {
+		t.Fatalf("Send error = %v, want the stale blockhash", err)
+	}
+	if flow.signs != 3 {
+		t.Fatalf("signed %d time(s), want 3", flow.signs)
+	}
+}
+
+func TestSendRebuildsOldTransaction(t *testing.T) {
+	flow := &fakeFlow{signDelay: 20 * time.Millisecond}
+	_, err := Send(flow, Options{MaxTxAge: 10 * time.Millisecond, MaxResigns: 2})
+	if err == nil {
+		t.Fatal("Send succeeded although every signature took longer than the maximum age")
+	}
+	if flow.broadcasts != 0 || flow.signs != 3 {
+		t.Fatalf("signed %d and broadcast %d time(s), want 3 and 0", flow.signs, flow.broadcasts)
+	}
+}
+
+func TestSendBeforeSignAborts(t *testing.T) {
+	flow := &fakeFlow{}
+	refused := errors.New("refusing dust transfer")
+	_, err := Send(flow, Options{BeforeSign: func(*solana.Transaction) error { return refused }})
+	if !errors.Is(err, refused) || flow.signs != 0 {
+		t.Fatalf("Send error = %v after %d signature(s), want the BeforeSign error and none", err, flow.signs)
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+
+	"signer/send"
+)
+
+// signingPort is a device that holds key: it answers GET_PUBKEY and signs
+// every base64 message it is sent.
+type signingPort struct {
+	fakePort
+	key      solana.PrivateKey
+	line     []byte
+	requests int
+}
+
+func (p *signingPort) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, c := range b {
+		if c != '\n' {
+			p.line = append(p.line, c)
+			continue
+		}
+		request := string(p.line)
+		p.line = nil
+		if request == "GET_PUBKEY" {
+			p.input = append(p.input, []byte(p.key.PublicKey().String()+"\n")...)
+			continue
+		}
+		p.requests++
+		msg, err := base64.StdEncoding.DecodeString(request)
+		if err != nil {
+			p.input = append(p.input, []byte("REJECTED\n")...)
+			continue
+		}
+		sig, err := p.key.Sign(msg)
+		if err != nil {
+			return 0, err
+		}
+		p.input = append(p.input, []byte(base64.StdEncoding.EncodeToString(sig[:])+"\n")...)
+	}
+	return len(b), nil
+}
+
+// open is a sendOptions.open connecting to p.
+func (p *signingPort) open() (*ESP32Signer, error) {
+	s := newESP32Signer(p)
+	s.stepTimeout = 5 * time.Second
+	s.skipPinCheck = true
+	return s, nil
+}
+
+func (p *signingPort) signRequests() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.requests
+}
+
+// rpcReply is the result or error a fake RPC method answers with.
+type rpcReply struct {
+	result interface{}
+	err    map[string]interface{}
+}
+
+// fakeRPC serves JSON-RPC requests from handlers keyed by method. A method
+// without a handler answers "Method not found".
+func fakeRPC(t *testing.T, handlers map[string]func(params []json.RawMessage) rpcReply) *rpc.Client {
+	return rpc.New(fakeRPCURL(t, handlers))
+}
+
+// fakeRPCURL is fakeRPC returning the endpoint URL instead of a client.
+func fakeRPCURL(t *testing.T, handlers map[string]func(params []json.RawMessage) rpcReply) string {
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     json.RawMessage   `json:"id"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		handler, ok := handlers[req.Method]
+		reply := rpcReply{err: map[string]interface{}{"code": -32601, "message": "Method not found"}}
+		if ok {
+			reply = handler(req.Params)
+		}
+		mu.Unlock()
+		resp := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+		if reply.err != nil {
+			resp["error"] = reply.err
+		} else {
+			resp["result"] = reply.result
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+// withContext wraps value in the context envelope most RPC results use.
+func withContext(value interface{}) rpcReply {
+	return rpcReply{result: map[string]interface{}{"context": map[string]interface{}{"slot": 100}, "value": value}}
+}
+
+// chainHandlers answers the calls a send makes besides simulation and
+// broadcast. Every transaction sent is reported finalized.
+func chainHandlers() map[string]func([]json.RawMessage) rpcReply {
+	blockhash := solana.HashFromBytes([]byte("fake-blockhash-fake-blockhash-32")).String()
+	return map[string]func([]json.RawMessage) rpcReply{
+		"getLatestBlockhash": func([]json.RawMessage) rpcReply {
+			return withContext(map[string]interface{}{"blockhash": blockhash, "lastValidBlockHeight": 200})
+		},
+		"getBalance":       func([]json.RawMessage) rpcReply { return withContext(10_000_000_000) },
+		"getFeeForMessage": func([]json.RawMessage) rpcReply { return withContext(5000) },
+		"simulateTransaction": func([]json.RawMessage) rpcReply {
+			return withContext(map[string]interface{}{"err": nil, "logs": []string{}, "unitsConsumed": 150})
+		},
+		"sendTransaction": func(params []json.RawMessage) rpcReply {
+			var encoded string
+			json.Unmarshal(params[0], &encoded)
+			tx, err := solana.TransactionFromBase64(encoded)
+			if err != nil {
+				return rpcReply{err: map[string]interface{}{"code": -32602, "message": err.Error()}}
+			}
+			return rpcReply{result: tx.Signatures[0].String()}
+		},
+		"getSignatureStatuses": func([]json.RawMessage) rpcReply {
+			return withContext([]interface{}{map[string]interface{}{"slot": 101, "err": nil, "confirmationStatus": "finalized"}})
+		},
+	}
+}
+
+// preflightError is the error sendTransaction answers with when preflight
+// simulation fails with err.
+func preflightError(err interface{}) rpcReply {
+	return rpcReply{err: map[string]interface{}{
+		"code":    -32002,
+		"message": "Transaction simulation failed",
+		"data":    map[string]interface{}{"err": err, "logs": []string{}},
+	}}
+}
+
+// runTestSend runs executeSend against client with a signing device and
+// returns the device for inspection.
+func runTestSend(t *testing.T, client *rpc.Client) (*signingPort, *send.Result, error) {
+	t.Helper()
+	oldWS := *wsURL
+	*wsURL = ""
+	t.Cleanup(func() { *wsURL = oldWS })
+
+	fs := flag.NewFlagSet("send", flag.ContinueOnError)
+	transfer := addTransferFlags(fs)
+	if err := fs.Parse([]string{"-to", solana.NewWallet().PublicKey().String(), "-amount", "1000000"}); err != nil {
+		t.Fatal(err)
+	}
+	port := &signingPort{key: solana.NewWallet().PrivateKey}
+	result, err := executeSend(client, sendOptions{params: transfer.params, open: port.open})
+	return port, result, err
+}
+
+func TestSendAbortsBeforeSigningOnSimulationError(t *testing.T) {
+	handlers := chainHandlers()
+	handlers["simulateTransaction"] = func([]json.RawMessage) rpcReply {
+		return withContext(map[string]interface{}{
+			"err":  map[string]interface{}{"InstructionError": []interface{}{0, map[string]interface{}{"Custom": 1}}},
+			"logs": []string{"Program 11111111111111111111111111111111 failed: custom program error: 0x1"},
+		})
+	}
+	sends := 0
+	handlers["sendTransaction"] = func([]json.RawMessage) rpcReply {
+		sends++
+		return rpcReply{result: solana.Signature{}.String()}
+	}
+
+	port, _, err := runTestSend(t, fakeRPC(t, handlers))
+	if err == nil || !strings.Contains(err.Error(), "simulation failed") {
+		t.Fatalf("executeSend error = %v, want a simulation failure", err)
+	}
+	if n := port.signRequests(); n != 0 {
+		t.Fatalf("device was asked to sign %d time(s), want 0", n)
+	}
+	if sends != 0 {
+		t.Fatalf("sendTransaction called %d time(s), want 0", sends)
+	}
+}
+
+func TestSendRefreshesBlockhashBeforeSigning(t *testing.T) {
+	handlers := chainHandlers()
+	simulated := handlers["simulateTransaction"]
+	simulations := 0
+	handlers["simulateTransaction"] = func(params []json.RawMessage) rpcReply {
+		simulations++
+		if simulations == 1 {
+			return withContext(map[string]interface{}{"err": "BlockhashNotFound", "logs": []string{}})
+		}
+		return simulated(params)
+	}
+
+	port, result, err := runTestSend(t, fakeRPC(t, handlers))
+	if err != nil {
+		t.Fatalf("executeSend: %v", err)
+	}
+	if result.Status != "confirmed" {
+		t.Fatalf("status = %q, want confirmed", result.Status)
+	}
+	if n := port.signRequests(); n != 1 {
+		t.Fatalf("device was asked to sign %d time(s), want 1", n)
+	}
+}
+
+func TestSendResignsOnPreflightBlockhashNotFound(t *testing.T) {
+	handlers := chainHandlers()
+	sent := handlers["sendTransaction"]
+	sends := 0
+	handlers["sendTransaction"] = func(params []json.RawMessage) rpcReply {
+		sends++
+		if sends == 1 {
+			return preflightError("BlockhashNotFound")
+		}
+		return sent(params)
+	}
+
+	port, result, err := runTestSend(t, fakeRPC(t, handlers))
+	if err != nil {
+		t.Fatalf("executeSend: %v", err)
+	}
+	if result.Status != "confirmed" {
+		t.Fatalf("status = %q, want confirmed", result.Status)
+	}
+	if n := port.signRequests(); n != 2 {
+		t.Fatalf("device was asked to sign %d time(s), want 2", n)
+	}
+}
+
+func TestSendAbortsOnOtherPreflightError(t *testing.T) {
+	handlers := chainHandlers()
+	handlers["sendTransaction"] = func([]json.RawMessage) rpcReply {
+		return preflightError(map[string]interface{}{"InstructionError": []interface{}{0, map[string]interface{}{"Custom": 1}}})
+	}
+
+	port, _, err := runTestSend(t, fakeRPC(t, handlers))
+	if err == nil {
+		t.Fatal("executeSend succeeded, want the preflight error")
+	}
+	if send.IsBlockhashNotFound(err) {
+		t.Fatalf("error %v was taken for BlockhashNotFound", err)
+	}
+	if n := port.signRequests(); n != 1 {
+		t.Fatalf("device was asked to sign %d time(s), want 1", n)
+	}
+}
+
+func TestTransferSummaryWithoutFee(t *testing.T) {
+	handlers := chainHandlers()
+	delete(handlers, "getFeeForMessage")
+	client := fakeRPC(t, handlers)
+	from := solana.NewWallet().PublicKey()
+	params := transferParams{From: from, FeePayer: from, Payments: []payment{{Recipient: solana.NewWallet().PublicKey(), Lamports: 1}}}
+	tx, err := solana.NewTransaction(transferInstructions(params), solana.Hash{1}, solana.TransactionPayer(from))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := printTransferSummary(io.Discard, client, params, tx, true); err == nil {
+		t.Fatal("printTransferSummary with -no-dust allowed a transfer whose fee is unknown")
+	}
+	before := warningCount()
+	if err := printTransferSummary(io.Discard, client, params, tx, false); err != nil {
+		t.Fatalf("printTransferSummary without -no-dust: %v", err)
+	}
+	if len(warningsSince(before)) == 0 {
+		t.Fatal("printTransferSummary did not warn that the fee is unknown")
+	}
+}
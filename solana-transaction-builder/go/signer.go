@@ -1,21 +1,22 @@
 package main
 
 import (
-	"bufio"
 	"context"
-	"encoding/base64"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
-	"strings"
+	"os"
 	"time"
 
-	"github.com/tarm/serial"
-
 	"github.com/gagliardetto/solana-go"
+	computebudget "github.com/gagliardetto/solana-go/programs/compute-budget"
+	"github.com/gagliardetto/solana-go/programs/memo"
 	"github.com/gagliardetto/solana-go/programs/system"
 	"github.com/gagliardetto/solana-go/rpc"
-	confirm "github.com/gagliardetto/solana-go/rpc/sendAndConfirmTransaction"
-	"github.com/gagliardetto/solana-go/rpc/ws"
+
+	"signer/send"
 )
 
 const (
@@ -26,157 +27,567 @@ const (
 	RPC_URL = "https://special-blue-fog.solana-mainnet.quiknode.pro/d009d548b4b9dd9f062a8124a868fb915937976c/"
 	// Provide a valid WebSocket endpoint. For mainnet-beta you can use:
 	WS_URL = "wss://special-blue-fog.solana-mainnet.quiknode.pro/d009d548b4b9dd9f062a8124a868fb915937976c/"
+	// MAX_RESIGN_ATTEMPTS bounds how often send rebuilds and re-signs a
+	// transaction that went stale before it could land.
+	MAX_RESIGN_ATTEMPTS = 3
 )
 
-// getESP32PublicKey writes "GET_PUBKEY\n" to the serial port, reads the public key string,
-// and converts it to a solana.PublicKey.
-func getESP32PublicKey(port *serial.Port) (solana.PublicKey, error) {
-	command := "GET_PUBKEY\n"
-	_, err := port.Write([]byte(command))
-	if err != nil {
-		return solana.PublicKey{}, err
-	}
-	fmt.Println("Requested public key from ESP32")
+// Global flags shared by every command. The defaults keep the behaviour of
+// running the binary without arguments unchanged.
+var (
+	serialPortName = flag.String("port", SERIAL_PORT, "serial port the ESP32 is attached to")
+	baudRate       = flag.Int("baud", 115200, "serial baud rate")
+	rpcURL         = flag.String("rpc", RPC_URL, "Solana RPC endpoint")
+	wsURL          = flag.String("ws", WS_URL, "Solana WebSocket endpoint used for confirmations (empty polls instead)")
+	wsRetries      = flag.Int("ws-retries", 3, "times to retry a failed WebSocket connection before falling back to polling")
+	wsBackoff      = flag.Duration("ws-backoff", 500*time.Millisecond, "delay before the first WebSocket retry, doubled on each attempt")
+	pollInterval   = flag.Duration("poll-interval", 2*time.Second, "how often to poll signature statuses when confirming without WebSocket")
+	minSlotFlag    = flag.Int64("min-context-slot", 0, "minimum context slot for sendTransaction: 0 uses the slot the blockhash was fetched at, -1 disables")
+	stepTimeout    = flag.Duration("step-timeout", 10*time.Second, "abort if the ESP32 does not answer a protocol step within this time")
+	signTimeout    = flag.Duration("sign-timeout", 60*time.Second, "abort if the ESP32 does not return a signature within this time, including the wait for the button press")
+	writeTimeout   = flag.Duration("write-timeout", 5*time.Second, "abort if sending the message to the ESP32 takes longer than this (0 disables)")
+)
 
-	reader := bufio.NewReader(port)
-	var pubkeyStr string
-	// Try reading up to 10 times with a delay.
-	for i := 0; i < 10; i++ {
-		line, err := reader.ReadString('\n')
-		if err == nil {
-			pubkeyStr = line
-			break
-		}
-		time.Sleep(1 * time.Second)
+// transferFlags holds the flags describing a SOL transfer.
+type transferFlags struct {
+	to               *string
+	lamports         *uint64
+	from             *string
+	feePayer         *string
+	memo             *string
+	computeUnitPrice *uint64
+	computeUnitLimit *uint
+	autoComputeLimit *bool
+	noDust           *bool
+}
+
+// addTransferFlags registers the transfer flags on fs.
+func addTransferFlags(fs *flag.FlagSet) *transferFlags {
+	return &transferFlags{
+		to:               fs.String("to", RECIPIENT_PUBLIC_KEY, "recipient public key"),
+		lamports:         fs.Uint64("amount", LAMPORTS_TO_SEND, "amount to send in lamports"),
+		from:             fs.String("from", "", "source wallet (defaults to the ESP32 public key)"),
+		feePayer:         fs.String("fee-payer", "", "fee payer (defaults to the source wallet)"),
+		memo:             fs.String("memo", "", "memo to attach to the transaction"),
+		computeUnitPrice: fs.Uint64("compute-unit-price", 0, "priority fee in micro-lamports per compute unit"),
+		computeUnitLimit: fs.Uint("compute-unit-limit", 0, "compute unit limit (0 keeps the network default)"),
+		autoComputeLimit: fs.Bool("auto-compute-limit", false, "with -compute-unit-price but no -compute-unit-limit, derive the limit by simulation"),
+		noDust:           fs.Bool("no-dust", false, "refuse transfers smaller than the estimated fee"),
 	}
-	pubkeyStr = strings.TrimSpace(pubkeyStr)
-	if pubkeyStr == "" {
-		return solana.PublicKey{}, fmt.Errorf("no public key received from ESP32")
+}
+
+// payment is a single SOL transfer to one recipient.
+type payment = send.Payment
+
+// transferParams describes the transaction built by createUnsignedTransaction.
+type transferParams struct {
+	From     solana.PublicKey
+	FeePayer solana.PublicKey
+	Payments []payment
+	// Memo is attached through the memo program when non-empty.
+	Memo string
+	// ComputeUnitPrice is the priority fee in micro-lamports per compute
+	// unit; zero adds no priority fee.
+	ComputeUnitPrice uint64
+	// ComputeUnitLimit caps the compute units; zero keeps the default.
+	ComputeUnitLimit uint32
+}
+
+// totalLamports is the sum of all payments.
+func (p transferParams) totalLamports() uint64 {
+	var total uint64
+	for _, pay := range p.Payments {
+		total += pay.Lamports
 	}
-	fmt.Println("Received ESP32 public key:", pubkeyStr)
-	return solana.PublicKeyFromBase58(pubkeyStr)
+	return total
 }
 
-// createUnsignedTransaction builds a transaction transferring lamports from the ESP32 wallet
-// (acting as fee payer) to the RECIPIENT_PUBLIC_KEY.
-func createUnsignedTransaction(client *rpc.Client, esp32Pubkey solana.PublicKey) (*solana.Transaction, error) {
-	recipient, err := solana.PublicKeyFromBase58(RECIPIENT_PUBLIC_KEY)
+// params resolves the flags into transferParams, using device as the source
+// wallet when -from was not given.
+func (f *transferFlags) params(device solana.PublicKey) (transferParams, error) {
+	p := transferParams{
+		From:             device,
+		Memo:             *f.memo,
+		ComputeUnitPrice: *f.computeUnitPrice,
+		ComputeUnitLimit: uint32(*f.computeUnitLimit),
+	}
+	recipient, err := solana.PublicKeyFromBase58(*f.to)
 	if err != nil {
-		return nil, err
+		return p, fmt.Errorf("invalid recipient %q: %w", *f.to, err)
 	}
+	p.Payments = []payment{{Recipient: recipient, Lamports: *f.lamports}}
+	if *f.from != "" {
+		if p.From, err = solana.PublicKeyFromBase58(*f.from); err != nil {
+			return p, fmt.Errorf("invalid source wallet %q: %w", *f.from, err)
+		}
+	}
+	p.FeePayer = p.From
+	if *f.feePayer != "" {
+		if p.FeePayer, err = solana.PublicKeyFromBase58(*f.feePayer); err != nil {
+			return p, fmt.Errorf("invalid fee payer %q: %w", *f.feePayer, err)
+		}
+	}
+	return p, nil
+}
+
+// blockhashInfo describes the RPC response a transaction's blockhash came from.
+type blockhashInfo struct {
+	// Slot is the context slot at which the node served the blockhash.
+	Slot                 uint64
+	LastValidBlockHeight uint64
+}
 
-	ctx := context.Background()
+// latestBlockhash fetches the latest finalized blockhash and where it was
+// observed. Clock skew findings are reported on out.
+func latestBlockhash(out io.Writer, client *rpc.Client) (solana.Hash, blockhashInfo, error) {
+	ctx, cancel := withOperationDeadline(context.Background())
+	defer cancel()
 	// Use GetLatestBlockhash (the new method) instead of GetRecentBlockhash.
 	resp, err := client.GetLatestBlockhash(ctx, rpc.CommitmentFinalized)
 	if err != nil {
-		return nil, err
+		return solana.Hash{}, blockhashInfo{}, deadlineError(PHASE_BUILD, err)
 	}
-	recentBlockhash := resp.Value.Blockhash
+	info := blockhashInfo{Slot: resp.Context.Slot, LastValidBlockHeight: resp.Value.LastValidBlockHeight}
+	checkClockSkew(ctx, out, client, info.Slot)
+	return resp.Value.Blockhash, info, nil
+}
 
-	// Build the transfer instruction using NewTransferInstruction.
-	instr := system.NewTransferInstruction(
-		LAMPORTS_TO_SEND,
-		esp32Pubkey,
-		recipient,
-	).Build()
+// buildTransaction wraps instructions in a transaction paid for by feePayer,
+// using the latest finalized blockhash. The returned blockhashInfo records
+// where the blockhash was observed.
+func buildTransaction(out io.Writer, client *rpc.Client, instructions []solana.Instruction, feePayer solana.PublicKey) (*solana.Transaction, blockhashInfo, error) {
+	blockhash, info, err := latestBlockhash(out, client)
+	if err != nil {
+		return nil, blockhashInfo{}, err
+	}
 
 	// Create the transaction; specify the fee payer using TransactionPayer.
 	tx, err := solana.NewTransaction(
-		[]solana.Instruction{instr},
-		recentBlockhash,
-		solana.TransactionPayer(esp32Pubkey),
+		instructions,
+		blockhash,
+		solana.TransactionPayer(feePayer),
 	)
 	if err != nil {
-		return nil, err
+		return nil, blockhashInfo{}, err
 	}
-	return tx, nil
+	return tx, info, nil
+}
+
+// createUnsignedTransaction builds a transaction paying every params.Payments
+// recipient from params.From, with params.FeePayer paying the fee.
+func createUnsignedTransaction(out io.Writer, client *rpc.Client, params transferParams) (*solana.Transaction, blockhashInfo, error) {
+	return buildTransaction(out, client, transferInstructions(params), params.FeePayer)
+}
+
+// transferInstructions returns the instructions of the transfer described by
+// params. Compute budget instructions come first and the memo last.
+func transferInstructions(params transferParams) []solana.Instruction {
+	var instructions []solana.Instruction
+	if params.ComputeUnitLimit > 0 {
+		instructions = append(instructions, computebudget.NewSetComputeUnitLimitInstruction(params.ComputeUnitLimit).Build())
+	}
+	if params.ComputeUnitPrice > 0 {
+		instructions = append(instructions, computebudget.NewSetComputeUnitPriceInstruction(params.ComputeUnitPrice).Build())
+	}
+	for _, pay := range params.Payments {
+		// Build the transfer instruction using NewTransferInstruction.
+		instructions = append(instructions, system.NewTransferInstruction(
+			pay.Lamports,
+			params.From,
+			pay.Recipient,
+		).Build())
+	}
+	if params.Memo != "" {
+		instructions = append(instructions, memo.NewMemoInstruction([]byte(params.Memo), params.From).Build())
+	}
+	return instructions
 }
 
-// sendToESP32AndGetSignature sends a base64-encoded message over the serial port
-// and waits for a base64-encoded signature response.
-func sendToESP32AndGetSignature(port *serial.Port, message string) (string, error) {
-	fullMessage := message + "\n"
-	_, err := port.Write([]byte(fullMessage))
+// signWithESP32 has the device sign tx and places the signature in the slot
+// of devicePubkey. Slots of other signers are left untouched.
+func signWithESP32(esp32 *ESP32Signer, devicePubkey solana.PublicKey, tx *solana.Transaction) error {
+	msgBytes, err := tx.Message.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("error serializing message: %w", err)
+	}
+
+	signature, err := signMessageWithESP32(esp32, msgBytes)
 	if err != nil {
-		return "", err
+		return fmt.Errorf("error receiving signature: %w", err)
+	}
+
+	// Attach the signature from ESP32 to the transaction.
+	return placeSignature(tx, devicePubkey, signature)
+}
+
+// printTransferSummary shows the amount being moved, the fee payer's balance
+// and the estimated fee. Transfers smaller than the fee are flagged as dust
+// and, with noDust, refused, as is any transfer whose fee is unknown.
+func printTransferSummary(out io.Writer, client *rpc.Client, params transferParams, tx *solana.Transaction, noDust bool) error {
+	for _, pay := range params.Payments {
+		fmt.Fprintf(out, "Transfer: %s from %s to %s\n", formatAmount(pay.Lamports), params.From, pay.Recipient)
 	}
-	fmt.Println("Sent to ESP32:", message)
 
-	reader := bufio.NewReader(port)
-	var sigStr string
-	for i := 0; i < 10; i++ {
-		line, err := reader.ReadString('\n')
-		if err == nil {
-			sigStr = line
-			break
+	ctx, cancel := withOperationDeadline(context.Background())
+	defer cancel()
+	if balance, err := client.GetBalance(ctx, params.FeePayer, rpc.CommitmentConfirmed); err == nil {
+		fmt.Fprintf(out, "Fee payer balance: %s\n", formatAmount(balance.Value))
+	}
+	fee, err := client.GetFeeForMessage(ctx, tx.Message.ToBase64(), rpc.CommitmentConfirmed)
+	if err == nil && fee.Value == nil {
+		err = fmt.Errorf("the node returned no fee for the message")
+	}
+	if err != nil {
+		if noDust {
+			return fmt.Errorf("refusing to send with -no-dust: the fee could not be estimated: %w", err)
 		}
-		time.Sleep(1 * time.Second)
+		warnTo(out, "could not estimate the fee, so dust transfers are not detected: %v", err)
+		return nil
 	}
-	sigStr = strings.TrimSpace(sigStr)
-	if sigStr == "" {
-		return "", fmt.Errorf("no signature received from ESP32")
+	fmt.Fprintf(out, "Estimated fee: %s\n", formatAmount(*fee.Value))
+	for _, pay := range params.Payments {
+		if pay.Lamports >= *fee.Value {
+			continue
+		}
+		if noDust {
+			return fmt.Errorf("refusing dust transfer of %s to %s: the fee is %s", formatAmount(pay.Lamports), pay.Recipient, formatAmount(*fee.Value))
+		}
+		warnTo(out, "transfer of %s to %s is smaller than the %s fee", formatAmount(pay.Lamports), pay.Recipient, formatAmount(*fee.Value))
 	}
-	fmt.Println("Received signature from ESP32:", sigStr)
-	return sigStr, nil
+	return nil
 }
 
-func main() {
-	serialConfig := &serial.Config{
-		Name:        SERIAL_PORT,
-		Baud:        115200,
-		ReadTimeout: time.Second * 1,
+// printRecipientBalance shows the recipient's SOL balance, flagging accounts
+// that do not exist yet since those are often a mistyped address.
+func printRecipientBalance(client *rpc.Client, recipient solana.PublicKey, when string) {
+	ctx, cancel := withOperationDeadline(context.Background())
+	defer cancel()
+	info, err := client.GetAccountInfo(ctx, recipient)
+	switch {
+	case errors.Is(err, rpc.ErrNotFound):
+		fmt.Printf("Recipient balance %s: account %s does not exist yet (new account)\n", when, recipient)
+	case err != nil:
+		fmt.Printf("Recipient balance %s: unavailable (%v)\n", when, err)
+	default:
+		fmt.Printf("Recipient balance %s: %s\n", when, formatAmount(info.Value.Lamports))
 	}
-	port, err := serial.OpenPort(serialConfig)
+}
+
+// runSend is the default command: it builds a transfer from the ESP32 wallet,
+// has the device sign it and broadcasts it.
+func runSend(args []string) error {
+	fs := flag.NewFlagSet("send", flag.ExitOnError)
+	transfer := addTransferFlags(fs)
+	previewOnly := fs.Bool("preview-only", false, "build and preview the transaction without opening the device (requires -from)")
+	showRecipient := fs.Bool("show-recipient-balance", false, "show the recipient's balance before and after sending")
+	maxTxAge := fs.Duration("max-tx-age", 0, "rebuild and re-sign if more than this passed between building and broadcasting (0 disables)")
+	verifyPort := fs.String("verify-port", "", "serial port of a backup device that must hold the same wallet before signing")
+	fs.Parse(args)
+
+	client, err := newRPCClient()
 	if err != nil {
-		log.Fatal("Error opening serial port:", err)
+		return err
 	}
-	defer port.Close()
 
-	client := rpc.New(RPC_URL)
+	if *previewOnly {
+		if *transfer.from == "" {
+			return fmt.Errorf("-preview-only needs -from since the device is not contacted")
+		}
+		params, err := transfer.params(solana.PublicKey{})
+		if err != nil {
+			return err
+		}
+		tx, blockhash, err := createUnsignedTransaction(os.Stdout, client, params)
+		if err != nil {
+			return fmt.Errorf("error creating transaction: %w", err)
+		}
+		if tx, _, err = checkComputeBudget(os.Stdout, client, &params, tx, blockhash, *transfer.autoComputeLimit); err != nil {
+			return err
+		}
+		if err := printTransferSummary(os.Stdout, client, params, tx, *transfer.noDust); err != nil {
+			return err
+		}
+		printTransactionPreview(tx, solana.PublicKey{})
+		return nil
+	}
 
-	esp32Pubkey, err := getESP32PublicKey(port)
+	opts := sendOptions{
+		params:           transfer.params,
+		autoComputeLimit: *transfer.autoComputeLimit,
+		noDust:           *transfer.noDust,
+		maxTxAge:         *maxTxAge,
+		verifyPort:       *verifyPort,
+	}
+	if *showRecipient {
+		opts.beforeSign = func(params transferParams) {
+			for _, pay := range params.Payments {
+				printRecipientBalance(client, pay.Recipient, "before")
+			}
+		}
+	}
+	result, err := executeSendWithRetries(client, opts)
 	if err != nil {
-		log.Fatal("Error getting ESP32 public key:", err)
+		return err
+	}
+	fmt.Println("Transaction submitted with signature:", result.Signature)
+	for _, pay := range result.Payments {
+		fmt.Printf("Confirmed transfer of %s to %s\n", formatAmount(pay.Lamports), pay.Recipient)
+		if *showRecipient {
+			printRecipientBalance(client, pay.Recipient, "after")
+		}
+	}
+	return nil
+}
+
+// sendOptions configures executeSend.
+type sendOptions struct {
+	// params describes the transfer once the device key is known.
+	params           func(device solana.PublicKey) (transferParams, error)
+	autoComputeLimit bool
+	noDust           bool
+	maxTxAge         time.Duration
+	verifyPort       string
+	// beforeSign, if set, runs once the transfer is built, before the
+	// device is asked to sign.
+	beforeSign func(params transferParams)
+	// open connects to the device; nil uses openESP32.
+	open func() (*ESP32Signer, error)
+	// out receives the progress messages; nil uses os.Stdout.
+	out io.Writer
+	// timer records the phases; nil times each attempt on its own.
+	timer *phaseTimer
+}
+
+// output returns the writer for progress messages.
+func (opts sendOptions) output() io.Writer {
+	if opts.out == nil {
+		return os.Stdout
 	}
+	return opts.out
+}
 
-	tx, err := createUnsignedTransaction(client, esp32Pubkey)
-	if err != nil {
-		log.Fatal("Error creating transaction:", err)
+// executeSend builds a transfer from the ESP32 wallet, has the device sign it
+// and broadcasts it through send.Send. The result is returned even on
+// failure, with as much filled in as the operation got to.
+func executeSend(client *rpc.Client, opts sendOptions) (result *send.Result, err error) {
+	result = &send.Result{Status: send.StatusFailed}
+	firstWarning := warningCount()
+	out := opts.output()
+	timer := opts.timer
+	if timer == nil {
+		timer = &phaseTimer{}
 	}
+	defer func() {
+		result.Warnings = warningsSince(firstWarning)
+		err = timer.fail(err)
+		timer.report(out)
+	}()
 
-	msgBytes, err := tx.Message.MarshalBinary()
+	timer.begin(PHASE_PORT_OPEN)
+	open := opts.open
+	if open == nil {
+		open = openESP32
+	}
+	esp32, err := open()
 	if err != nil {
-		log.Fatal("Error serializing message:", err)
+		return result, err
 	}
-	base64Message := base64.StdEncoding.EncodeToString(msgBytes)
-	fmt.Println("Serialized Transaction Message (Base64):", base64Message)
+	defer esp32.Close()
+	esp32.timer = timer
+	esp32.out = out
 
-	base64Signature, err := sendToESP32AndGetSignature(port, base64Message)
+	timer.begin(PHASE_PUBKEY)
+	esp32Pubkey, err := getESP32PublicKey(esp32)
 	if err != nil {
-		log.Fatal("Error receiving signature:", err)
+		return result, fmt.Errorf("error getting ESP32 public key: %w", err)
 	}
 
-	sigBytes, err := base64.StdEncoding.DecodeString(base64Signature)
+	timer.begin(PHASE_BUILD)
+	params, err := opts.params(esp32Pubkey)
 	if err != nil {
-		log.Fatal("Error decoding signature:", err)
+		return result, err
+	}
+	if !params.From.Equals(esp32Pubkey) || !params.FeePayer.Equals(esp32Pubkey) {
+		return result, fmt.Errorf("send only signs with the connected device; use bundle-create for other signers")
 	}
-	var signature solana.Signature
-	copy(signature[:], sigBytes)
+	flow := &deviceFlow{
+		client:           client,
+		esp32:            esp32,
+		pubkey:           esp32Pubkey,
+		params:           params,
+		autoComputeLimit: opts.autoComputeLimit,
+		timer:            timer,
+		out:              out,
+	}
+	return send.Send(flow, send.Options{
+		Payments:   params.Payments,
+		MaxTxAge:   opts.maxTxAge,
+		MaxResigns: MAX_RESIGN_ATTEMPTS,
+		Out:        out,
+		BeforeSign: func(tx *solana.Transaction) error {
+			if err := printTransferSummary(out, client, flow.params, tx, opts.noDust); err != nil {
+				return err
+			}
+			if opts.beforeSign != nil {
+				opts.beforeSign(flow.params)
+			}
+			if opts.verifyPort != "" {
+				return verifyBackupDevice(out, opts.verifyPort, esp32Pubkey)
+			}
+			return nil
+		},
+	})
+}
 
-	// Attach the signature from ESP32 to the transaction.
-	tx.Signatures = []solana.Signature{signature}
+// deviceFlow is the send.Flow of a transfer signed by the connected ESP32.
+type deviceFlow struct {
+	client           *rpc.Client
+	esp32            *ESP32Signer
+	pubkey           solana.PublicKey
+	params           transferParams
+	autoComputeLimit bool
+	timer            *phaseTimer
+	out              io.Writer
+	// blockhash is where the blockhash of the last build was observed.
+	blockhash blockhashInfo
+	built     bool
+}
 
-	// Open a WebSocket connection for transaction confirmation.
-	wsClient, err := ws.Connect(context.Background(), WS_URL)
+// Build builds the transfer on the latest blockhash. The first build also
+// settles the compute budget, which later builds reuse.
+func (f *deviceFlow) Build() (*solana.Transaction, error) {
+	if f.built {
+		if err := checkDeadline(PHASE_BUILD); err != nil {
+			return nil, err
+		}
+	}
+	f.timer.begin(PHASE_BUILD)
+	tx, blockhash, err := createUnsignedTransaction(f.out, f.client, f.params)
 	if err != nil {
-		log.Fatal("Error connecting to WS:", err)
+		return nil, fmt.Errorf("error creating transaction: %w", err)
+	}
+	if !f.built {
+		if tx, blockhash, err = checkComputeBudget(f.out, f.client, &f.params, tx, blockhash, f.autoComputeLimit); err != nil {
+			return nil, err
+		}
+		f.built = true
 	}
-	defer wsClient.Close()
+	f.blockhash = blockhash
+	return tx, nil
+}
+
+func (f *deviceFlow) Simulate(tx *solana.Transaction) error {
+	return simulateBeforeSigning(f.out, f.client, tx)
+}
 
-	// Send the transaction and wait for confirmation.
-	sig, err := confirm.SendAndConfirmTransaction(context.TODO(), client, wsClient, tx)
+func (f *deviceFlow) Sign(tx *solana.Transaction) error {
+	f.timer.begin(PHASE_SIGN)
+	return signWithESP32(f.esp32, f.pubkey, tx)
+}
+
+func (f *deviceFlow) Broadcast(tx *solana.Transaction) (send.Confirmation, error) {
+	_, report, err := broadcastWithReport(f.out, f.client, tx, f.blockhash.Slot, f.timer)
+	if err != nil || report == nil {
+		return send.Confirmation{}, err
+	}
+	return send.Confirmation{Slot: report.Slot, Fee: report.Fee}, nil
+}
+
+// verifyBackupDevice reads the public key of the device on port and checks it
+// is the same wallet as the primary device.
+func verifyBackupDevice(out io.Writer, port string, primary solana.PublicKey) error {
+	if port == *serialPortName {
+		return fmt.Errorf("-verify-port must name a different port than -port")
+	}
+	backup, err := openESP32Port(port)
+	if err != nil {
+		return fmt.Errorf("backup device: %w", err)
+	}
+	defer backup.Close()
+	backup.out = out
+	backupPubkey, err := getESP32PublicKey(backup)
 	if err != nil {
-		log.Fatal("Error sending transaction:", err)
+		return fmt.Errorf("error getting backup device public key: %w", err)
+	}
+	if !backupPubkey.Equals(primary) {
+		return fmt.Errorf("backup device on %s holds %s, not %s; refusing to sign", port, backupPubkey, primary)
+	}
+	fmt.Fprintln(out, "Backup device on", port, "holds the same wallet")
+	return nil
+}
+
+// command is a subcommand of the CLI.
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{"send", "build, sign and broadcast a SOL transfer (default)", runSend},
+	{"bundle-create", "write an unsigned transfer to a signature bundle file", runBundleCreate},
+	{"bundle-sign", "add the connected device's signature to a bundle", runBundleSign},
+	{"bundle-broadcast", "broadcast a bundle once every signature is collected", runBundleBroadcast},
+	{"airdrop", "request test SOL on devnet, testnet or localnet", runAirdrop},
+	{"broadcast-dir", "broadcast every signed transaction file in a drop folder", runBroadcastDir},
+	{"burn", "burn SPL tokens held by the ESP32 wallet", runBurn},
+	{"transfer-token", "send SPL tokens from the ESP32 wallet", runTransferToken},
+	{"create-ata", "create a wallet's associated token account without transferring", runCreateATA},
+	{"sweep-tokens", "move every token in the ESP32 wallet elsewhere, optionally closing the accounts", runSweepTokens},
+	{"monitor", "watch the ESP32 wallet for incoming transactions", runMonitor},
+	{"estimate", "simulate a transfer and suggest a compute unit limit for it", runEstimate},
+	{"build-tx", "build a transfer and print it unsigned for external signing", runBuildTx},
+	{"json", "read a transaction request as JSON on stdin and print the result as JSON", runJSON},
+	{"signers", "list the signers a transaction requires and which the ESP32 covers", runSigners},
+	{"retry", "re-sign a failed transaction with a fresh blockhash and broadcast it", runRetry},
+	{"sign-tx", "sign an externally built transaction with the ESP32", runSignTx},
+	{"sign-offchain", "sign a message in the Solana off-chain message format", runSignOffchain},
+	{"firmware", "show the device firmware version and optionally pin it", runFirmware},
+	{"receive", "show the ESP32 address as a QR code for receiving funds", runReceive},
+	{"validate-config", "check saved profiles and pins without contacting the device or network", runValidateConfig},
+	{"profile", "add, list, use or remove saved device profiles", runProfile},
+	{"fixture", "write the deterministic transfer fixture used for compatibility tests", runFixture},
+}
+
+// configCommands manage the saved configuration and run without applying it.
+var configCommands = map[string]bool{"profile": true, "validate-config": true}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [global flags] [command] [command flags]\n\nCommands:\n", os.Args[0])
+	for _, c := range commands {
+		fmt.Fprintf(flag.CommandLine.Output(), "  %-18s %s\n", c.name, c.usage)
+	}
+	fmt.Fprintln(flag.CommandLine.Output(), "\nGlobal flags:")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	name, args := "send", flag.Args()
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+	// The config commands must work even when the saved profiles are broken.
+	if !configCommands[name] {
+		if err := applyProfile(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := applyNetwork(); err != nil {
+		log.Fatal(err)
+	}
+	startDeadline()
+
+	for _, c := range commands {
+		if c.name == name {
+			if err := c.run(args); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
 	}
-	fmt.Println("Transaction submitted with signature:", sig)
+	fmt.Fprintf(flag.CommandLine.Output(), "unknown command %q\n\n", name)
+	usage()
+	os.Exit(2)
 }
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	bin "github.com/gagliardetto/binary"
+	"github.com/gagliardetto/solana-go"
+	"github.com/mr-tron/base58"
+)
+
+// placeSignature stores sig in the slot of signer. The signature slice is
+// sized from the message header, so slots belonging to other signers stay
+// zero until they sign and existing signatures are never reordered.
+func placeSignature(tx *solana.Transaction, signer solana.PublicKey, sig solana.Signature) error {
+	required := int(tx.Message.Header.NumRequiredSignatures)
+	if len(tx.Message.AccountKeys) < required {
+		return fmt.Errorf("message lists %d accounts but requires %d signatures", len(tx.Message.AccountKeys), required)
+	}
+	if len(tx.Signatures) != required {
+		signatures := make([]solana.Signature, required)
+		copy(signatures, tx.Signatures)
+		tx.Signatures = signatures
+	}
+	for i, key := range tx.Message.AccountKeys[:required] {
+		if key.Equals(signer) {
+			tx.Signatures[i] = sig
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is not a required signer of this transaction", signer)
+}
+
+// missingSignatures lists the signers whose slot in tx is still empty.
+func missingSignatures(tx *solana.Transaction) []solana.PublicKey {
+	var missing []solana.PublicKey
+	for i, signer := range tx.Message.Signers() {
+		if i >= len(tx.Signatures) || tx.Signatures[i].IsZero() {
+			missing = append(missing, signer)
+		}
+	}
+	return missing
+}
+
+// verifyPresentSignatures checks that every filled signature slot of tx
+// verifies, leaving empty slots to the signers still missing.
+func verifyPresentSignatures(tx *solana.Transaction) error {
+	msgBytes, err := tx.Message.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	for i, signer := range tx.Message.Signers() {
+		if i >= len(tx.Signatures) || tx.Signatures[i].IsZero() {
+			continue
+		}
+		if !tx.Signatures[i].Verify(signer, msgBytes) {
+			return fmt.Errorf("signature in the slot of %s does not verify", signer)
+		}
+	}
+	return nil
+}
+
+// validateSignedTransaction checks that tx carries exactly the signatures
+// its header requires and that each of them verifies.
+func validateSignedTransaction(tx *solana.Transaction) error {
+	if missing := missingSignatures(tx); len(missing) > 0 {
+		return fmt.Errorf("missing %d signature(s), first from %s", len(missing), missing[0])
+	}
+	return tx.VerifySignatures()
+}
+
+// decodeTransactionBytes parses raw as a serialized transaction or, failing
+// that, as a bare message. Trailing bytes are an error, so bytes decoded with
+// the wrong encoding are not taken for a transaction.
+func decodeTransactionBytes(raw []byte) (*solana.Transaction, error) {
+	var tx solana.Transaction
+	dec := bin.NewBinDecoder(raw)
+	if err := tx.UnmarshalWithDecoder(dec); err == nil && dec.Remaining() == 0 &&
+		len(tx.Signatures) == int(tx.Message.Header.NumRequiredSignatures) {
+		return &tx, nil
+	}
+	var msg solana.Message
+	dec = bin.NewBinDecoder(raw)
+	if err := msg.UnmarshalWithDecoder(dec); err != nil {
+		return nil, fmt.Errorf("input is neither a transaction nor a message: %w", err)
+	}
+	if dec.Remaining() != 0 {
+		return nil, fmt.Errorf("input is neither a transaction nor a message: %d trailing bytes", dec.Remaining())
+	}
+	return &solana.Transaction{Message: msg}, nil
+}
+
+// decodeEncodedTransaction decodes s with encoding, or with whichever of
+// base64 and base58 yields a transaction when encoding is empty. Every base58
+// string is also valid base64 when its length is a multiple of 4, so input
+// that parses both ways is refused rather than guessed.
+func decodeEncodedTransaction(s, encoding string) (*solana.Transaction, error) {
+	decoders := map[string]func(string) ([]byte, error){
+		"base64": base64.StdEncoding.DecodeString,
+		"base58": base58.Decode,
+	}
+	if encoding != "" {
+		decode, ok := decoders[encoding]
+		if !ok {
+			return nil, fmt.Errorf("unknown encoding %q (want base64 or base58)", encoding)
+		}
+		raw, err := decode(s)
+		if err != nil {
+			return nil, fmt.Errorf("input is not %s: %w", encoding, err)
+		}
+		return decodeTransactionBytes(raw)
+	}
+	var tx *solana.Transaction
+	var lastErr error
+	for _, name := range []string{"base64", "base58"} {
+		raw, err := decoders[name](s)
+		if err != nil {
+			continue
+		}
+		parsed, err := decodeTransactionBytes(raw)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if tx != nil {
+			return nil, fmt.Errorf("input parses as a transaction in both base64 and base58; pass -encoding")
+		}
+		tx = parsed
+	}
+	if tx != nil {
+		return tx, nil
+	}
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, fmt.Errorf("input is neither base64 nor base58")
+}
+
+// decodeTransactionInput parses an externally built transaction given either
+// as a serialized transaction or as a bare message, in base64 or base58, or
+// as the JSON written by build-tx or a signature bundle. encoding names the
+// encoding of raw input; empty accepts either when only one parses.
+func decodeTransactionInput(data []byte, encoding string) (*solana.Transaction, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '{' {
+		var built unsignedTransaction
+		if err := json.Unmarshal(data, &built); err != nil {
+			return nil, fmt.Errorf("error parsing build-tx output: %w", err)
+		}
+		// Signature bundles only carry the message, always in base64.
+		data = []byte(built.Transaction)
+		if built.Transaction == "" {
+			data = []byte(built.Message)
+		}
+		encoding = built.Encoding
+		if encoding == "" {
+			encoding = "base64"
+		}
+	}
+	return decodeEncodedTransaction(string(data), encoding)
+}
+
+// readTransactionInput reads the file at path, or stdin when path is "-", and
+// decodes it with decodeTransactionInput.
+func readTransactionInput(path, encoding string) (*solana.Transaction, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeTransactionInput(data, encoding)
+}
+
+// runSignTx adds the ESP32 signature to an externally built transaction and
+// either writes the result or broadcasts it once fully signed.
+func runSignTx(args []string) error {
+	fs := flag.NewFlagSet("sign-tx", flag.ExitOnError)
+	in := fs.String("in", "-", "file with the base64/base58 transaction or message (- for stdin)")
+	out := fs.String("out", "-", "file to write the signed transaction to (- for stdout)")
+	encoding := fs.String("encoding", "", "encoding of raw input: base64 or base58 (default: whichever parses as a transaction)")
+	broadcast := fs.Bool("broadcast", false, "broadcast the transaction once every signature is present")
+	fs.Parse(args)
+
+	tx, err := readTransactionInput(*in, *encoding)
+	if err != nil {
+		return err
+	}
+
+	esp32, err := openESP32()
+	if err != nil {
+		return err
+	}
+	defer esp32.Close()
+
+	esp32Pubkey, err := getESP32PublicKey(esp32)
+	if err != nil {
+		return fmt.Errorf("error getting ESP32 public key: %w", err)
+	}
+	if !tx.Message.IsSigner(esp32Pubkey) {
+		return fmt.Errorf("device key %s is not a required signer of this transaction", esp32Pubkey)
+	}
+	if err := signWithESP32(esp32, esp32Pubkey, tx); err != nil {
+		return err
+	}
+	if err := verifyPresentSignatures(tx); err != nil {
+		return fmt.Errorf("refusing to write the transaction: %w", err)
+	}
+
+	missing := missingSignatures(tx)
+	fmt.Fprintf(os.Stderr, "Signed slot of %s; %d of %d signature(s) still missing\n",
+		esp32Pubkey, len(missing), tx.Message.Header.NumRequiredSignatures)
+
+	if *broadcast {
+		client, err := newRPCClient()
+		if err != nil {
+			return err
+		}
+		sig, err := broadcastTransaction(client, tx, 0, nil)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Transaction submitted with signature:", sig)
+		return nil
+	}
+
+	encoded, err := tx.ToBase64()
+	if err != nil {
+		return err
+	}
+	if *out == "-" {
+		fmt.Println(encoded)
+		return nil
+	}
+	return os.WriteFile(*out, []byte(encoded+"\n"), 0o600)
+}
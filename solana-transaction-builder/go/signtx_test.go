@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/programs/system"
+	"github.com/mr-tron/base58"
+)
+
+// base58AlsoBase64 returns a transaction whose base58 encoding is also valid
+// base64, by adding transfers until the length is a multiple of 4.
+func base58AlsoBase64(t *testing.T) (*solana.Transaction, string) {
+	t.Helper()
+	from := solana.NewWallet().PublicKey()
+	to := solana.NewWallet().PublicKey()
+	var instructions []solana.Instruction
+	for {
+		instructions = append(instructions, system.NewTransferInstruction(1000, from, to).Build())
+		tx, err := solana.NewTransaction(
+			instructions,
+			solana.Hash{1},
+			solana.TransactionPayer(from),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx.Signatures = make([]solana.Signature, tx.Message.Header.NumRequiredSignatures)
+		raw, err := tx.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := base58.Encode(raw)
+		if _, err := base64.StdEncoding.DecodeString(s); err == nil {
+			return tx, s
+		}
+	}
+}
+
+func TestDecodeTransactionInputBase58LooksLikeBase64(t *testing.T) {
+	want, s := base58AlsoBase64(t)
+	for _, encoding := range []string{"", "base58"} {
+		tx, err := decodeTransactionInput([]byte(s), encoding)
+		if err != nil {
+			t.Fatalf("decodeTransactionInput(encoding %q): %v", encoding, err)
+		}
+		if !tx.Message.RecentBlockhash.Equals(want.Message.RecentBlockhash) || len(tx.Message.AccountKeys) != len(want.Message.AccountKeys) {
+			t.Fatalf("decodeTransactionInput(encoding %q) decoded a different transaction", encoding)
+		}
+	}
+	if _, err := decodeTransactionInput([]byte(s), "base64"); err == nil {
+		t.Fatal("decoding base58 input as -encoding base64 succeeded")
+	}
+}
+
+func TestDecodeTransactionInputBase64(t *testing.T) {
+	want, _ := base58AlsoBase64(t)
+	raw, err := want.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := decodeTransactionInput([]byte(base64.StdEncoding.EncodeToString(raw)+"\n"), "")
+	if err != nil {
+		t.Fatalf("decodeTransactionInput: %v", err)
+	}
+	if !tx.Message.AccountKeys[0].Equals(want.Message.AccountKeys[0]) {
+		t.Fatal("decodeTransactionInput decoded a different fee payer")
+	}
+}
+
+func TestDecodeTransactionInputRejectsGarbage(t *testing.T) {
+	_, err := decodeTransactionInput([]byte(strings.Repeat("abcd", 40)), "")
+	if err == nil {
+		t.Fatal("decodeTransactionInput accepted input that is no transaction")
+	}
+}
+
+func TestVerifyPresentSignatures(t *testing.T) {
+	payer := solana.NewWallet().PrivateKey
+	other := solana.NewWallet().PublicKey()
+	tx, err := solana.NewTransaction(
+		[]solana.Instruction{system.NewTransferInstruction(1000, other, payer.PublicKey()).Build()},
+		solana.Hash{1},
+		solana.TransactionPayer(payer.PublicKey()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgBytes, err := tx.Message.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := payer.Sign(msgBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := placeSignature(tx, payer.PublicKey(), signature); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyPresentSignatures(tx); err != nil {
+		t.Fatalf("verifyPresentSignatures with the slot of %s still empty: %v", other, err)
+	}
+
+	signature[0] ^= 0xff
+	if err := placeSignature(tx, payer.PublicKey(), signature); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyPresentSignatures(tx); err == nil {
+		t.Fatal("verifyPresentSignatures accepted a garbled signature")
+	}
+}
+
+func TestReadTransactionInputFile(t *testing.T) {
+	tx, encoded := base58AlsoBase64(t)
+	path := filepath.Join(t.TempDir(), "tx.txt")
+	if err := os.WriteFile(path, []byte(encoded+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readTransactionInput(path, "base58")
+	if err != nil {
+		t.Fatalf("readTransactionInput: %v", err)
+	}
+	if !got.Message.RecentBlockhash.Equals(tx.Message.RecentBlockhash) || len(got.Message.Instructions) != len(tx.Message.Instructions) {
+		t.Fatal("readTransactionInput decoded a different transaction")
+	}
+	if _, err := readTransactionInput(filepath.Join(t.TempDir(), "missing"), ""); err == nil {
+		t.Fatal("readTransactionInput of a missing file succeeded")
+	}
+}
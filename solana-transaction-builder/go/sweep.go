@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	bin "github.com/gagliardetto/binary"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/programs/token"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// MAX_TRANSACTION_SIZE is the largest serialized transaction the network
+// accepts.
+const MAX_TRANSACTION_SIZE = 1232
+
+// transactionSize returns the serialized size of a transaction holding
+// instructions, paid and signed by payer alone.
+func transactionSize(instructions []solana.Instruction, payer solana.PublicKey) (int, error) {
+	tx, err := solana.NewTransaction(instructions, solana.Hash{}, solana.TransactionPayer(payer))
+	if err != nil {
+		return 0, err
+	}
+	msg, err := tx.Message.MarshalBinary()
+	if err != nil {
+		return 0, err
+	}
+	signatures := int(tx.Message.Header.NumRequiredSignatures)
+	return len(msg) + 1 + signatures*solana.SignatureLength, nil
+}
+
+// sweepItem is the instructions that empty one token account, and the rent
+// its closing reclaims.
+type sweepItem struct {
+	instructions []solana.Instruction
+	rent         uint64
+}
+
+// batchSweep groups items into transactions that stay within
+// MAX_TRANSACTION_SIZE, keeping each item's instructions together.
+func batchSweep(items []sweepItem, payer solana.PublicKey) ([][]sweepItem, error) {
+	var batches [][]sweepItem
+	var current []sweepItem
+	var instructions []solana.Instruction
+	for _, item := range items {
+		candidate := append(append([]solana.Instruction{}, instructions...), item.instructions...)
+		size, err := transactionSize(candidate, payer)
+		if err != nil {
+			return nil, err
+		}
+		if size > MAX_TRANSACTION_SIZE && len(current) > 0 {
+			batches = append(batches, current)
+			current, instructions = nil, nil
+			candidate = item.instructions
+			if size, err = transactionSize(candidate, payer); err != nil {
+				return nil, err
+			}
+		}
+		if size > MAX_TRANSACTION_SIZE {
+			return nil, fmt.Errorf("instructions for one account do not fit in a transaction")
+		}
+		current = append(current, item)
+		instructions = candidate
+	}
+	if len(current) > 0 {
+		batches = append(batches, current)
+	}
+	return batches, nil
+}
+
+// runSweepTokens moves every token the ESP32 wallet holds to another wallet
+// and, with -close, closes the emptied accounts to reclaim their rent.
+func runSweepTokens(args []string) error {
+	fs := flag.NewFlagSet("sweep-tokens", flag.ExitOnError)
+	toFlag := fs.String("to", "", "wallet to move all tokens to")
+	closeAccounts := fs.Bool("close", false, "close each emptied token account to reclaim its rent")
+	rentTo := fs.String("rent-to", "", "where reclaimed rent goes (defaults to the ESP32 wallet)")
+	concurrency := fs.Int("concurrency", 1, "how many batches to build, sign and confirm at once; signing still happens one at a time")
+	queueTimeout := fs.Duration("queue-timeout", 5*time.Minute, "how long a batch may wait for the device while others are signed")
+	fs.Parse(args)
+	if *concurrency < 1 {
+		return fmt.Errorf("-concurrency must be at least 1")
+	}
+
+	recipient, err := solana.PublicKeyFromBase58(*toFlag)
+	if err != nil {
+		return fmt.Errorf("invalid recipient %q: %w", *toFlag, err)
+	}
+
+	ctx, cancel := withOperationDeadline(context.Background())
+	defer cancel()
+	client, err := newRPCClient()
+	if err != nil {
+		return err
+	}
+	esp32, err := openESP32()
+	if err != nil {
+		return err
+	}
+	defer esp32.Close()
+	owner, err := getESP32PublicKey(esp32)
+	if err != nil {
+		return fmt.Errorf("error getting ESP32 public key: %w", err)
+	}
+	if recipient.Equals(owner) {
+		return fmt.Errorf("cannot sweep the ESP32 wallet to itself")
+	}
+	rentDestination := owner
+	if *rentTo != "" {
+		if rentDestination, err = solana.PublicKeyFromBase58(*rentTo); err != nil {
+			return fmt.Errorf("invalid rent destination %q: %w", *rentTo, err)
+		}
+	}
+
+	mints := map[solana.PublicKey]tokenMint{}
+	var items []sweepItem
+	for _, program := range tokenPrograms() {
+		resp, err := client.GetTokenAccountsByOwner(ctx, owner,
+			&rpc.GetTokenAccountsConfig{ProgramId: program.ToPointer()},
+			&rpc.GetTokenAccountsOpts{Encoding: solana.EncodingBase64})
+		if err != nil {
+			return fmt.Errorf("error listing token accounts: %w", err)
+		}
+		for _, ta := range resp.Value {
+			var acc token.Account
+			if err := bin.NewBinDecoder(ta.Account.Data.GetBinary()).Decode(&acc); err != nil {
+				return fmt.Errorf("error decoding token account %s: %w", ta.Pubkey, err)
+			}
+			mint, ok := mints[acc.Mint]
+			if !ok {
+				if mint, err = fetchMint(ctx, client, acc.Mint); err != nil {
+					return err
+				}
+				mints[acc.Mint] = mint
+			}
+			item, err := sweepAccount(ta.Pubkey, acc, mint, owner, recipient, *closeAccounts, rentDestination)
+			if err != nil {
+				return err
+			}
+			if len(item.instructions) == 0 {
+				continue
+			}
+			if *closeAccounts {
+				item.rent = ta.Account.Lamports
+			}
+			fmt.Printf("Sweeping %s of %s from %s\n", formatTokenAmount(acc.Amount, mint.Decimals), mint.Address, ta.Pubkey)
+			items = append(items, item)
+		}
+	}
+	if len(items) == 0 {
+		fmt.Println("Nothing to sweep")
+		return nil
+	}
+
+	batches, err := batchSweep(items, owner)
+	if err != nil {
+		return err
+	}
+	device := newLockedSigner(esp32, *concurrency-1, *queueTimeout)
+	var mu sync.Mutex
+	var reclaimed uint64
+	var failed int
+	jobs := make(chan int)
+	var workers sync.WaitGroup
+	for w := 0; w < *concurrency; w++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for i := range jobs {
+				rent, sig, err := sweepBatch(ctx, client, device, owner, batches[i])
+				mu.Lock()
+				if err != nil {
+					failed++
+					fmt.Printf("Batch %d of %d failed: %v\n", i+1, len(batches), err)
+				} else {
+					reclaimed += rent
+					fmt.Printf("Batch %d of %d (%d account(s)) confirmed: %s\n", i+1, len(batches), len(batches[i]), sig)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range batches {
+		jobs <- i
+	}
+	close(jobs)
+	workers.Wait()
+
+	if *closeAccounts {
+		fmt.Printf("Reclaimed %s of rent to %s\n", formatAmount(reclaimed), rentDestination)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d batch(es) failed", failed, len(batches))
+	}
+	return nil
+}
+
+// sweepBatch builds, signs and broadcasts one batch, returning the rent its
+// closed accounts reclaimed.
+func sweepBatch(ctx context.Context, client *rpc.Client, device *lockedSigner, owner solana.PublicKey, batch []sweepItem) (uint64, solana.Signature, error) {
+	var instructions []solana.Instruction
+	var rent uint64
+	for _, item := range batch {
+		instructions = append(instructions, item.instructions...)
+		rent += item.rent
+	}
+	// The blockhash is fetched once the device is free so it cannot expire
+	// while the batch waits for other batches to be signed.
+	var tx *solana.Transaction
+	var blockhash blockhashInfo
+	err := device.do(ctx, func(signer *ESP32Signer) error {
+		var err error
+		if tx, blockhash, err = buildTransaction(os.Stdout, client, instructions, owner); err != nil {
+			return fmt.Errorf("error creating transaction: %w", err)
+		}
+		return signWithESP32(signer, owner, tx)
+	})
+	if err != nil {
+		return 0, solana.Signature{}, err
+	}
+	sig, err := broadcastTransaction(client, tx, blockhash.Slot, nil)
+	if err != nil {
+		return 0, sig, err
+	}
+	return rent, sig, nil
+}
+
+// sweepAccount returns the instructions that move the whole balance of
+// account to recipient's associated token account and optionally close it.
+func sweepAccount(account solana.PublicKey, acc token.Account, mint tokenMint, owner, recipient solana.PublicKey, closeAccount bool, rentDestination solana.PublicKey) (sweepItem, error) {
+	var item sweepItem
+	if acc.Amount > 0 {
+		destination, err := associatedTokenAddress(recipient, mint)
+		if err != nil {
+			return item, err
+		}
+		createATA, err := createATAInstruction(owner, recipient, mint)
+		if err != nil {
+			return item, err
+		}
+		transfer, err := withProgram(token.NewTransferCheckedInstruction(
+			acc.Amount, mint.Decimals, account, mint.Address, destination, owner, nil,
+		).Build(), mint.Program)
+		if err != nil {
+			return item, err
+		}
+		item.instructions = append(item.instructions, createATA, transfer)
+	}
+	if closeAccount {
+		closeInst, err := withProgram(token.NewCloseAccountInstruction(
+			account, rentDestination, owner, nil,
+		).Build(), mint.Program)
+		if err != nil {
+			return item, err
+		}
+		item.instructions = append(item.instructions, closeInst)
+	}
+	return item, nil
+}
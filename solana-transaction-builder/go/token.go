@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	bin "github.com/gagliardetto/binary"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/programs/token"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// pubkeyFlag is a flag.Value that only accepts valid public keys.
+type pubkeyFlag solana.PublicKey
+
+func (p *pubkeyFlag) String() string { return solana.PublicKey(*p).String() }
+
+func (p *pubkeyFlag) Set(s string) error {
+	key, err := solana.PublicKeyFromBase58(s)
+	if err != nil {
+		return fmt.Errorf("invalid public key %q: %w", s, err)
+	}
+	*p = pubkeyFlag(key)
+	return nil
+}
+
+// tokenProgramID and ataProgramID are the SPL Token and Associated Token
+// Account programs, overridable for forks and test deployments.
+var (
+	tokenProgramID = solana.TokenProgramID
+	ataProgramID   = solana.SPLAssociatedTokenAccountProgramID
+)
+
+func init() {
+	flag.Var((*pubkeyFlag)(&tokenProgramID), "token-program", "SPL Token program ID")
+	flag.Var((*pubkeyFlag)(&ataProgramID), "ata-program", "Associated Token Account program ID")
+}
+
+// tokenPrograms lists the token programs whose mints are supported, each
+// once even when -token-program names Token-2022.
+func tokenPrograms() []solana.PublicKey {
+	if tokenProgramID.Equals(solana.Token2022ProgramID) {
+		return []solana.PublicKey{tokenProgramID}
+	}
+	return []solana.PublicKey{tokenProgramID, solana.Token2022ProgramID}
+}
+
+// tokenMint is a mint together with the token program that owns it, which is
+// either the classic SPL Token program or Token-2022.
+type tokenMint struct {
+	Address  solana.PublicKey
+	Program  solana.PublicKey
+	Decimals uint8
+}
+
+// fetchMint loads mint and determines which token program it belongs to.
+func fetchMint(ctx context.Context, client *rpc.Client, mint solana.PublicKey) (tokenMint, error) {
+	info, err := client.GetAccountInfo(ctx, mint)
+	if err != nil {
+		if errors.Is(err, rpc.ErrNotFound) {
+			return tokenMint{}, fmt.Errorf("mint %s does not exist", mint)
+		}
+		return tokenMint{}, fmt.Errorf("error fetching mint %s: %w", mint, err)
+	}
+	owner := info.Value.Owner
+	known := false
+	for _, program := range tokenPrograms() {
+		known = known || owner.Equals(program)
+	}
+	if !known {
+		return tokenMint{}, fmt.Errorf("%s is owned by %s, not a token program", mint, owner)
+	}
+	var m token.Mint
+	if err := bin.NewBinDecoder(info.Value.Data.GetBinary()).Decode(&m); err != nil {
+		return tokenMint{}, fmt.Errorf("error decoding mint %s: %w", mint, err)
+	}
+	return tokenMint{Address: mint, Program: owner, Decimals: m.Decimals}, nil
+}
+
+// associatedTokenAddress derives the associated token account of wallet for
+// the mint, honouring the mint's token program.
+func associatedTokenAddress(wallet solana.PublicKey, mint tokenMint) (solana.PublicKey, error) {
+	addr, _, err := solana.FindProgramAddress(
+		[][]byte{wallet[:], mint.Program[:], mint.Address[:]},
+		ataProgramID,
+	)
+	return addr, err
+}
+
+// createATAInstruction builds the idempotent CreateAssociatedTokenAccount
+// instruction for wallet's account of mint, paid by payer. It succeeds when
+// the account already exists.
+func createATAInstruction(payer, wallet solana.PublicKey, mint tokenMint) (solana.Instruction, error) {
+	ata, err := associatedTokenAddress(wallet, mint)
+	if err != nil {
+		return nil, err
+	}
+	accounts := solana.AccountMetaSlice{
+		solana.Meta(payer).WRITE().SIGNER(),
+		solana.Meta(ata).WRITE(),
+		solana.Meta(wallet),
+		solana.Meta(mint.Address),
+		solana.Meta(solana.SystemProgramID),
+		solana.Meta(mint.Program),
+	}
+	// Instruction 1 of the associated token account program is CreateIdempotent.
+	return solana.NewInstruction(ataProgramID, accounts, []byte{1}), nil
+}
+
+// accountExists reports whether account exists on chain.
+func accountExists(ctx context.Context, client *rpc.Client, account solana.PublicKey) (bool, error) {
+	_, err := client.GetAccountInfo(ctx, account)
+	if errors.Is(err, rpc.ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// fetchTokenAccount loads an explicitly given token account and checks that it
+// is held by mint's token program and belongs to mint.
+func fetchTokenAccount(ctx context.Context, client *rpc.Client, account solana.PublicKey, mint tokenMint) (token.Account, error) {
+	info, err := client.GetAccountInfo(ctx, account)
+	if err != nil {
+		if errors.Is(err, rpc.ErrNotFound) {
+			return token.Account{}, fmt.Errorf("token account %s does not exist", account)
+		}
+		return token.Account{}, fmt.Errorf("error fetching token account %s: %w", account, err)
+	}
+	if owner := info.Value.Owner; !owner.Equals(mint.Program) {
+		return token.Account{}, fmt.Errorf("%s is owned by %s, not the mint's token program %s", account, owner, mint.Program)
+	}
+	var acc token.Account
+	if err := bin.NewBinDecoder(info.Value.Data.GetBinary()).Decode(&acc); err != nil {
+		return token.Account{}, fmt.Errorf("error decoding token account %s: %w", account, err)
+	}
+	if !acc.Mint.Equals(mint.Address) {
+		return token.Account{}, fmt.Errorf("token account %s holds mint %s, not %s", account, acc.Mint, mint.Address)
+	}
+	return acc, nil
+}
+
+// tokenBalance returns the raw balance of a token account.
+func tokenBalance(ctx context.Context, client *rpc.Client, account solana.PublicKey) (uint64, error) {
+	resp, err := client.GetTokenAccountBalance(ctx, account, rpc.CommitmentConfirmed)
+	if err != nil {
+		return 0, fmt.Errorf("error fetching balance of token account %s: %w", account, err)
+	}
+	return strconv.ParseUint(resp.Value.Amount, 10, 64)
+}
+
+// withProgram rebuilds a token instruction for another token program. The
+// instruction layouts shared by SPL Token and Token-2022 are identical, so
+// only the program ID changes.
+func withProgram(inst solana.Instruction, program solana.PublicKey) (solana.Instruction, error) {
+	data, err := inst.Data()
+	if err != nil {
+		return nil, err
+	}
+	return solana.NewInstruction(program, inst.Accounts(), data), nil
+}
+
+// parseTokenAmount converts a decimal token amount such as "1.5" into base
+// units, rejecting amounts with more precision than the mint supports.
+func parseTokenAmount(s string, decimals uint8) (uint64, error) {
+	whole, frac, _ := strings.Cut(s, ".")
+	if len(frac) > int(decimals) {
+		return 0, fmt.Errorf("amount %s has more than %d decimals", s, decimals)
+	}
+	digits := whole + frac + strings.Repeat("0", int(decimals)-len(frac))
+	n, ok := new(big.Int).SetString(digits, 10)
+	if !ok || n.Sign() < 0 || !n.IsUint64() {
+		return 0, fmt.Errorf("invalid token amount %q", s)
+	}
+	return n.Uint64(), nil
+}
+
+// formatTokenAmount renders a raw token amount with the mint's decimals.
+func formatTokenAmount(amount uint64, decimals uint8) string {
+	s := fmt.Sprintf("%0*d", int(decimals)+1, amount)
+	if decimals == 0 {
+		return s
+	}
+	whole, frac := s[:len(s)-int(decimals)], strings.TrimRight(s[len(s)-int(decimals):], "0")
+	if frac == "" {
+		return whole
+	}
+	return whole + "." + frac
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+func TestTokenProgramsListsEachOnce(t *testing.T) {
+	defer func(old solana.PublicKey) { tokenProgramID = old }(tokenProgramID)
+	for _, program := range []solana.PublicKey{solana.TokenProgramID, solana.Token2022ProgramID, solana.NewWallet().PublicKey()} {
+		tokenProgramID = program
+		seen := map[solana.PublicKey]bool{}
+		for _, p := range tokenPrograms() {
+			if seen[p] {
+				t.Fatalf("tokenPrograms with -token-program %s lists %s twice", program, p)
+			}
+			seen[p] = true
+		}
+		if !seen[program] || !seen[solana.Token2022ProgramID] {
+			t.Fatalf("tokenPrograms with -token-program %s = %v", program, tokenPrograms())
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/programs/token"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// checkTokenFunds makes sure source exists and holds at least amount, so an
+// impossible transfer fails before the device is asked to sign it.
+func checkTokenFunds(ctx context.Context, client *rpc.Client, source solana.PublicKey, mint tokenMint, amount uint64) error {
+	exists, err := accountExists(ctx, client, source)
+	if err != nil {
+		return fmt.Errorf("error fetching token account %s: %w", source, err)
+	}
+	if !exists {
+		return fmt.Errorf("source token account %s does not exist: the wallet holds no %s", source, mint.Address)
+	}
+	balance, err := tokenBalance(ctx, client, source)
+	if err != nil {
+		return err
+	}
+	if balance < amount {
+		return fmt.Errorf("insufficient token balance in %s: available %s, requested %s",
+			source, formatTokenAmount(balance, mint.Decimals), formatTokenAmount(amount, mint.Decimals))
+	}
+	return nil
+}
+
+// runTransferToken sends SPL tokens from the ESP32 wallet to a recipient
+// wallet, creating the recipient's associated token account if needed.
+// -source-account and -destination-account replace the associated token
+// accounts for layouts that do not use them.
+func runTransferToken(args []string) error {
+	fs := flag.NewFlagSet("transfer-token", flag.ExitOnError)
+	mintFlag := fs.String("mint", "", "mint of the token to send")
+	toFlag := fs.String("to", "", "recipient wallet")
+	amountFlag := fs.String("amount", "", "amount to send, in tokens (e.g. 1.5)")
+	sourceFlag := fs.String("source-account", "", "token account to send from instead of the wallet's associated token account")
+	destinationFlag := fs.String("destination-account", "", "token account to send to instead of the recipient's associated token account (replaces -to)")
+	fs.Parse(args)
+
+	mintAddr, err := solana.PublicKeyFromBase58(*mintFlag)
+	if err != nil {
+		return fmt.Errorf("invalid mint %q: %w", *mintFlag, err)
+	}
+	var recipient, source, destination solana.PublicKey
+	if *destinationFlag != "" {
+		if *toFlag != "" {
+			return fmt.Errorf("use either -to or -destination-account, not both")
+		}
+		if destination, err = solana.PublicKeyFromBase58(*destinationFlag); err != nil {
+			return fmt.Errorf("invalid destination account %q: %w", *destinationFlag, err)
+		}
+	} else if recipient, err = solana.PublicKeyFromBase58(*toFlag); err != nil {
+		return fmt.Errorf("invalid recipient %q: %w", *toFlag, err)
+	}
+	if *sourceFlag != "" {
+		if source, err = solana.PublicKeyFromBase58(*sourceFlag); err != nil {
+			return fmt.Errorf("invalid source account %q: %w", *sourceFlag, err)
+		}
+	}
+
+	ctx, cancel := withOperationDeadline(context.Background())
+	defer cancel()
+	client, err := newRPCClient()
+	if err != nil {
+		return err
+	}
+	mint, err := fetchMint(ctx, client, mintAddr)
+	if err != nil {
+		return err
+	}
+	amount, err := parseTokenAmount(*amountFlag, mint.Decimals)
+	if err != nil {
+		return err
+	}
+	if amount == 0 {
+		return fmt.Errorf("transfer amount must be greater than zero")
+	}
+
+	esp32, err := openESP32()
+	if err != nil {
+		return err
+	}
+	defer esp32.Close()
+
+	owner, err := getESP32PublicKey(esp32)
+	if err != nil {
+		return fmt.Errorf("error getting ESP32 public key: %w", err)
+	}
+	if source.IsZero() {
+		if source, err = associatedTokenAddress(owner, mint); err != nil {
+			return err
+		}
+	} else {
+		acc, err := fetchTokenAccount(ctx, client, source, mint)
+		if err != nil {
+			return err
+		}
+		if !acc.Owner.Equals(owner) {
+			return fmt.Errorf("source account %s belongs to %s, not the device wallet %s", source, acc.Owner, owner)
+		}
+	}
+	if err := checkTokenFunds(ctx, client, source, mint, amount); err != nil {
+		return err
+	}
+
+	var instructions []solana.Instruction
+	if destination.IsZero() {
+		if destination, err = associatedTokenAddress(recipient, mint); err != nil {
+			return err
+		}
+		createATA, err := createATAInstruction(owner, recipient, mint)
+		if err != nil {
+			return err
+		}
+		instructions = append(instructions, createATA)
+	} else if _, err := fetchTokenAccount(ctx, client, destination, mint); err != nil {
+		return err
+	}
+	transfer, err := withProgram(token.NewTransferCheckedInstruction(
+		amount, mint.Decimals, source, mint.Address, destination, owner, nil,
+	).Build(), mint.Program)
+	if err != nil {
+		return err
+	}
+	instructions = append(instructions, transfer)
+	tx, blockhash, err := buildTransaction(os.Stdout, client, instructions, owner)
+	if err != nil {
+		return fmt.Errorf("error creating transaction: %w", err)
+	}
+	fmt.Printf("Transferring %s of %s from %s to %s\n",
+		formatTokenAmount(amount, mint.Decimals), mint.Address, source, destination)
+
+	if err := signWithESP32(esp32, owner, tx); err != nil {
+		return err
+	}
+	sig, err := broadcastTransaction(client, tx, blockhash.Slot, nil)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Transaction submitted with signature:", sig)
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// amountUnits selects how amounts are displayed. Amounts are always handled in
+// lamports internally and only converted when printed.
+type amountUnits string
+
+const (
+	unitsLamports amountUnits = "lamports"
+	unitsSOL      amountUnits = "sol"
+	unitsAuto     amountUnits = "auto"
+)
+
+func (u *amountUnits) String() string { return string(*u) }
+
+func (u *amountUnits) Set(s string) error {
+	switch v := amountUnits(strings.ToLower(s)); v {
+	case unitsLamports, unitsSOL, unitsAuto:
+		*u = v
+		return nil
+	}
+	return fmt.Errorf("unknown units %q (want lamports, sol or auto)", s)
+}
+
+var displayUnits = unitsAuto
+
+func init() {
+	flag.Var(&displayUnits, "units", "how amounts are displayed: lamports, sol or auto")
+}
+
+// formatSOL renders lamports as a decimal SOL amount without rounding.
+func formatSOL(lamports uint64) string {
+	whole := lamports / solana.LAMPORTS_PER_SOL
+	frac := lamports % solana.LAMPORTS_PER_SOL
+	if frac == 0 {
+		return fmt.Sprintf("%d SOL", whole)
+	}
+	return fmt.Sprintf("%d.%s SOL", whole, strings.TrimRight(fmt.Sprintf("%09d", frac), "0"))
+}
+
+// formatAmount renders lamports according to the -units flag.
+func formatAmount(lamports uint64) string {
+	switch displayUnits {
+	case unitsLamports:
+		return fmt.Sprintf("%d lamports", lamports)
+	case unitsSOL:
+		return formatSOL(lamports)
+	}
+	return fmt.Sprintf("%s (%d lamports)", formatSOL(lamports), lamports)
+}
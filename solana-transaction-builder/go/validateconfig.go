@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// BAUD_RATES are the serial speeds the ESP32 USB bridges support.
+var BAUD_RATES = map[int]bool{
+	9600: true, 19200: true, 38400: true, 57600: true, 115200: true,
+	230400: true, 460800: true, 921600: true,
+}
+
+// checkURL reports a problem with raw as an endpoint using one of schemes.
+func checkURL(raw string, schemes ...string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	for _, s := range schemes {
+		if u.Scheme == s {
+			if u.Host == "" {
+				return fmt.Errorf("%q has no host", raw)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("%q does not use %v", raw, schemes)
+}
+
+// validateProfile returns every problem found in p.
+func validateProfile(p deviceProfile) []error {
+	var problems []error
+	if p.Baud != 0 && !BAUD_RATES[p.Baud] {
+		problems = append(problems, fmt.Errorf("baud %d is not a supported rate", p.Baud))
+	}
+	if p.Network != "" {
+		if _, ok := networks[p.Network]; !ok {
+			problems = append(problems, fmt.Errorf("unknown network %q", p.Network))
+		}
+	}
+	if p.RPC != "" {
+		if err := checkURL(p.RPC, "http", "https"); err != nil {
+			problems = append(problems, fmt.Errorf("rpc: %w", err))
+		}
+	}
+	if p.WS != "" {
+		if err := checkURL(p.WS, "ws", "wss"); err != nil {
+			problems = append(problems, fmt.Errorf("ws: %w", err))
+		}
+	}
+	if p.Pubkey != "" {
+		if key, err := solana.PublicKeyFromBase58(p.Pubkey); err != nil {
+			problems = append(problems, fmt.Errorf("pubkey: %w", err))
+		} else if key.IsZero() || !solana.IsOnCurve(key[:]) {
+			problems = append(problems, fmt.Errorf("pubkey %s is not a valid device key", key))
+		}
+	}
+	return problems
+}
+
+// validatePins returns every problem found in the firmware pins, ordered by
+// device key.
+func validatePins(pins map[string]string) []error {
+	keys := make([]string, 0, len(pins))
+	for key := range pins {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var problems []error
+	for _, key := range keys {
+		if _, err := solana.PublicKeyFromBase58(key); err != nil {
+			problems = append(problems, fmt.Errorf("invalid device key %q: %w", key, err))
+		}
+		if pins[key] == "" {
+			problems = append(problems, fmt.Errorf("empty firmware version for %s", key))
+		}
+	}
+	return problems
+}
+
+// runValidateConfig checks the saved profiles and firmware pins without
+// contacting the device or the network.
+func runValidateConfig(args []string) error {
+	fs := flag.NewFlagSet("validate-config", flag.ExitOnError)
+	dirFlag := fs.String("dir", "", "config directory to check (defaults to -config-dir)")
+	fs.Parse(args)
+
+	dir := *dirFlag
+	if dir == "" {
+		var err error
+		if dir, err = configDir(); err != nil {
+			return err
+		}
+	}
+
+	var problems []string
+	report := func(file string, err error) {
+		problems = append(problems, fmt.Sprintf("%s: %v", file, err))
+	}
+	read := func(name string, v interface{}) bool {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			return false
+		}
+		if err == nil {
+			err = json.Unmarshal(data, v)
+		}
+		if err != nil {
+			report(name, err)
+			return false
+		}
+		return true
+	}
+
+	var store profileStore
+	if read(PROFILES_FILE, &store) {
+		names := make([]string, 0, len(store.Profiles))
+		for name := range store.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			for _, err := range validateProfile(store.Profiles[name]) {
+				report(PROFILES_FILE, fmt.Errorf("profile %s: %w", name, err))
+			}
+		}
+		if _, ok := store.Profiles[store.Active]; store.Active != "" && !ok {
+			report(PROFILES_FILE, fmt.Errorf("active profile %q does not exist", store.Active))
+		}
+	}
+	pins := map[string]string{}
+	if read(FIRMWARE_PINS_FILE, &pins) {
+		for _, err := range validatePins(pins) {
+			report(FIRMWARE_PINS_FILE, err)
+		}
+	}
+
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problem(s) in %s", len(problems), dir)
+	}
+	fmt.Println("Config in", dir, "is valid")
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestValidatePinsOrdersProblems(t *testing.T) {
+	pins := map[string]string{}
+	for i := 0; i < 20; i++ {
+		pins[fmt.Sprintf("bad-key-%02d", i)] = ""
+	}
+	first := fmt.Sprint(validatePins(pins))
+	for i := 0; i < 10; i++ {
+		if got := fmt.Sprint(validatePins(pins)); got != first {
+			t.Fatalf("validatePins reported problems in a different order:\n%s\n%s", first, got)
+		}
+	}
+	if got := validatePins(pins); len(got) != 40 {
+		t.Fatalf("validatePins found %d problems, want 40", len(got))
+	}
+}
+
+func TestValidateProfile(t *testing.T) {
+	tests := []struct {
+		name     string
+		profile  deviceProfile
+		problems int
+	}{
+		{"empty", deviceProfile{}, 0},
+		{"valid", deviceProfile{Baud: 115200, Network: "devnet", RPC: "https://api.devnet.solana.com", WS: "wss://api.devnet.solana.com", Pubkey: "AKnL4NNf3DGWZJS6cPknBuEGnVsV4A4m5tgebLHaRSZ9"}, 0},
+		{"bad baud", deviceProfile{Baud: 1234}, 1},
+		{"unknown network", deviceProfile{Network: "moonnet"}, 1},
+		{"wrong schemes", deviceProfile{RPC: "ws://host", WS: "https://host"}, 2},
+		{"zero pubkey", deviceProfile{Pubkey: "11111111111111111111111111111111"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := validateProfile(tt.profile)
+			if len(got) != tt.problems {
+				t.Fatalf("validateProfile = %v, want %d problem(s)", got, tt.problems)
+			}
+		})
+	}
+}